@@ -5,9 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+
+	"github.com/peterstace/simplefeatures/geom"
 )
 
 var ErrInvalidMagic = errors.New("invalid magic")
+var ErrInvalidVersion = errors.New("invalid version")
+var ErrInvalidEnvelope = errors.New("invalid envelope contents indicator code")
+var ErrInconsistentEmpty = errors.New("empty flag does not match geometry")
+var ErrOutsideEnvelope = errors.New("geometry outside of header envelope")
 
 var ExtensionTWKB = []byte{'T', 'W', 'K', 'B'}
 
@@ -15,9 +22,18 @@ var ExtensionTWKB = []byte{'T', 'W', 'K', 'B'}
 type Header struct {
 	HeaderTop
 	HeaderSrs
+	Envelope
 	ExtensionCode []byte
 }
 
+// Envelope is the bounding box of the geometry stored in the header.
+// Only the values included by the EnvelopeContentsIndicatorCode are set.
+type Envelope struct {
+	MinX, MaxX, MinY, MaxY float64
+	MinZ, MaxZ             float64
+	MinM, MaxM             float64
+}
+
 func Read(r io.Reader) (*Header, error) {
 	b := &Header{}
 	err := binary.Read(r, binary.LittleEndian, &b.HeaderTop)
@@ -32,14 +48,10 @@ func Read(r io.Reader) (*Header, error) {
 	if err != nil {
 		return nil, err
 	}
-	envsize := int64(b.EnvelopeContentsIndicatorCode().Size())
-	n, err := io.CopyN(io.Discard, r, envsize)
+	err = b.readEnvelope(r, bo)
 	if err != nil {
 		return nil, err
 	}
-	if n != envsize {
-		return nil, io.EOF
-	}
 	if b.Type() == ExtendedType {
 		b.ExtensionCode = make([]byte, 4)
 		n, err := r.Read(b.ExtensionCode)
@@ -53,8 +65,194 @@ func Read(r io.Reader) (*Header, error) {
 	return b, nil
 }
 
+// ParseHeader parses the header at the start of the geometry blob b and
+// returns it with the offset of the geometry payload in b. Unlike Read it
+// does not allocate, the ExtensionCode of the header refers to b.
+func ParseHeader(b []byte) (Header, int, error) {
+	var h Header
+	if len(b) < 8 {
+		return h, 0, io.ErrUnexpectedEOF
+	}
+	h.Magic = [2]byte{b[0], b[1]}
+	h.Version = b[2]
+	h.Flags = b[3]
+	if h.Magic != [2]byte{0x47, 0x50} {
+		return h, 0, ErrInvalidMagic
+	}
+	bo := h.ByteOrder()
+	h.SrsId = int32(bo.Uint32(b[4:8]))
+	n := 8
+
+	c := h.EnvelopeContentsIndicatorCode()
+	size := c.Size()
+	if len(b) < n+size {
+		return h, 0, io.ErrUnexpectedEOF
+	}
+	var v [8]float64
+	for i := 0; i < size/8; i++ {
+		v[i] = math.Float64frombits(bo.Uint64(b[n+i*8:]))
+	}
+	h.Envelope = envelopeValues(c, v)
+	n += size
+
+	if h.Type() == ExtendedType {
+		if len(b) < n+4 {
+			return h, 0, io.ErrUnexpectedEOF
+		}
+		h.ExtensionCode = b[n : n+4 : n+4]
+		n += 4
+	}
+	return h, n, nil
+}
+
+// Validate returns an error if the header has a version other than 0,
+// i.e. version 1 of the spec, or an invalid envelope contents indicator
+// code. Read and ParseHeader accept both to be lenient with writers.
+func (b *Header) Validate() error {
+	if b.Version != 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidVersion, b.Version)
+	}
+	if c := b.EnvelopeContentsIndicatorCode(); c > XYZM {
+		return fmt.Errorf("%w: %d", ErrInvalidEnvelope, c)
+	}
+	return nil
+}
+
+// ValidateGeometry returns ErrInconsistentEmpty if the empty flag of the
+// header does not match whether the decoded geometry g is empty.
+func (b *Header) ValidateGeometry(g geom.Geometry) error {
+	if b.Empty() != g.IsEmpty() {
+		return fmt.Errorf("%w: empty flag %v", ErrInconsistentEmpty, b.Empty())
+	}
+	return nil
+}
+
+// ValidateEnvelope returns ErrOutsideEnvelope if the XY coordinates of the
+// geometry g decoded from payload are outside of the envelope of the
+// header. Writers commonly compute the envelope of TWKB geometries before
+// rounding their coordinates to the precision of the payload, so these
+// may be outside of it by up to one unit of that precision.
+func (b *Header) ValidateEnvelope(g geom.Geometry, payload []byte) error {
+	if b.EnvelopeContentsIndicatorCode().Size() == 0 {
+		return nil
+	}
+	e, c := EnvelopeOf(g)
+	if c == NoEnvelope {
+		return nil
+	}
+	tolerance := 0.0
+	if b.Type() == ExtendedType && string(b.ExtensionCode) == string(ExtensionTWKB) && len(payload) > 0 {
+		// The precision is zigzag encoded in the upper 4 bits
+		v := int(payload[0] >> 4)
+		tolerance = math.Pow10(-(v>>1 ^ -(v & 1)))
+	}
+	if e.MinX < b.MinX-tolerance || e.MaxX > b.MaxX+tolerance ||
+		e.MinY < b.MinY-tolerance || e.MaxY > b.MaxY+tolerance {
+		return ErrOutsideEnvelope
+	}
+	return nil
+}
+
+func (b *Header) readEnvelope(r io.Reader, bo binary.ByteOrder) error {
+	var v [8]float64
+	c := b.EnvelopeContentsIndicatorCode()
+	n := c.Size() / 8
+	if n == 0 {
+		return nil
+	}
+	err := binary.Read(r, bo, v[:n])
+	if err != nil {
+		return err
+	}
+	b.Envelope = envelopeValues(c, v)
+	return nil
+}
+
+// envelopeValues returns the envelope of the values in the order they
+// are stored for the code c
+func envelopeValues(c EnvelopeContentsIndicatorCode, v [8]float64) Envelope {
+	if c.Size() == 0 {
+		return Envelope{}
+	}
+	e := Envelope{MinX: v[0], MaxX: v[1], MinY: v[2], MaxY: v[3]}
+	switch c {
+	case XYZ:
+		e.MinZ, e.MaxZ = v[4], v[5]
+	case XYM:
+		e.MinM, e.MaxM = v[4], v[5]
+	case XYZM:
+		e.MinZ, e.MaxZ = v[4], v[5]
+		e.MinM, e.MaxM = v[6], v[7]
+	}
+	return e
+}
+
+func (b *Header) writeEnvelope(w io.Writer, bo binary.ByteOrder) error {
+	var v []float64
+	switch b.EnvelopeContentsIndicatorCode() {
+	case NoEnvelope:
+		return nil
+	case XY:
+		v = []float64{b.MinX, b.MaxX, b.MinY, b.MaxY}
+	case XYZ:
+		v = []float64{b.MinX, b.MaxX, b.MinY, b.MaxY, b.MinZ, b.MaxZ}
+	case XYM:
+		v = []float64{b.MinX, b.MaxX, b.MinY, b.MaxY, b.MinM, b.MaxM}
+	case XYZM:
+		v = []float64{b.MinX, b.MaxX, b.MinY, b.MaxY, b.MinZ, b.MaxZ, b.MinM, b.MaxM}
+	}
+	return binary.Write(w, bo, v)
+}
+
+// SetEnvelope sets the envelope of the header to the bounds of g,
+// including Z and M ranges if g has them. The envelope is removed if g
+// is empty.
+func (b *Header) SetEnvelope(g geom.Geometry) {
+	e, c := EnvelopeOf(g)
+	b.Envelope = e
+	b.SetEnvelopeContentsIndicatorCode(c)
+}
+
+// EnvelopeOf returns the envelope of g and the matching envelope contents
+// indicator code for the coordinate type of g, or NoEnvelope if g is empty.
+func EnvelopeOf(g geom.Geometry) (Envelope, EnvelopeContentsIndicatorCode) {
+	seq := g.DumpCoordinates()
+	n := seq.Length()
+	if n == 0 {
+		return Envelope{}, NoEnvelope
+	}
+	ct := seq.CoordinatesType()
+	c0 := seq.Get(0)
+	e := Envelope{
+		MinX: c0.X, MaxX: c0.X,
+		MinY: c0.Y, MaxY: c0.Y,
+		MinZ: c0.Z, MaxZ: c0.Z,
+		MinM: c0.M, MaxM: c0.M,
+	}
+	for i := 1; i < n; i++ {
+		c := seq.Get(i)
+		e.MinX, e.MaxX = math.Min(e.MinX, c.X), math.Max(e.MaxX, c.X)
+		e.MinY, e.MaxY = math.Min(e.MinY, c.Y), math.Max(e.MaxY, c.Y)
+		e.MinZ, e.MaxZ = math.Min(e.MinZ, c.Z), math.Max(e.MaxZ, c.Z)
+		e.MinM, e.MaxM = math.Min(e.MinM, c.M), math.Max(e.MaxM, c.M)
+	}
+	switch ct {
+	case geom.DimXYZ:
+		e.MinM, e.MaxM = 0, 0
+		return e, XYZ
+	case geom.DimXYM:
+		e.MinZ, e.MaxZ = 0, 0
+		return e, XYM
+	case geom.DimXYZM:
+		return e, XYZM
+	default:
+		e.MinZ, e.MaxZ, e.MinM, e.MaxM = 0, 0, 0, 0
+		return e, XY
+	}
+}
+
 func (b *Header) Write(w io.Writer) error {
-	if b.EnvelopeContentsIndicatorCode() != NoEnvelope {
+	if b.EnvelopeContentsIndicatorCode() > XYZM {
 		return fmt.Errorf("unsupported envelope %s", b.EnvelopeContentsIndicatorCode().String())
 	}
 	if b.Type() == ExtendedType && len(b.ExtensionCode) != 4 {
@@ -68,6 +266,10 @@ func (b *Header) Write(w io.Writer) error {
 	if err != nil {
 		return err
 	}
+	err = b.writeEnvelope(w, b.ByteOrder())
+	if err != nil {
+		return err
+	}
 	if b.Type() == ExtendedType {
 		n, err := w.Write(b.ExtensionCode)
 		if n != 4 {
@@ -99,7 +301,17 @@ const (
 )
 
 func (b *Header) String() string {
-	return fmt.Sprintf("Header{HeaderTop: %s, HeaderSrs: %s, ExtensionCode: %v}", b.HeaderTop.String(), b.HeaderSrs.String(), b.ExtensionCode)
+	return fmt.Sprintf("Header{HeaderTop: %s, HeaderSrs: %s, Envelope: %s, ExtensionCode: %v}", b.HeaderTop.String(), b.HeaderSrs.String(), b.Envelope.String(), b.ExtensionCode)
+}
+
+func (e *Envelope) String() string {
+	return fmt.Sprintf("Envelope{X: [%g, %g], Y: [%g, %g], Z: [%g, %g], M: [%g, %g]}", e.MinX, e.MaxX, e.MinY, e.MaxY, e.MinZ, e.MaxZ, e.MinM, e.MaxM)
+}
+
+// ContainsXY reports whether the point x, y is inside the XY bounds of
+// the envelope, including its boundary.
+func (e *Envelope) ContainsXY(x, y float64) bool {
+	return x >= e.MinX && x <= e.MaxX && y >= e.MinY && y <= e.MaxY
 }
 
 func (h *HeaderTop) String() string {
@@ -141,6 +353,14 @@ func (h *HeaderTop) Empty() bool {
 	return (h.Flags&0b0001_0000)>>4 == 1
 }
 
+func (h *HeaderTop) SetEmpty(empty bool) {
+	if empty {
+		h.Flags |= 0b0001_0000
+	} else {
+		h.Flags &^= 0b0001_0000
+	}
+}
+
 type EnvelopeContentsIndicatorCode uint8
 
 const (
@@ -204,3 +424,11 @@ func (h *HeaderTop) ByteOrder() binary.ByteOrder {
 		return nil
 	}
 }
+
+func (h *HeaderTop) SetByteOrder(bo binary.ByteOrder) {
+	if bo == binary.LittleEndian {
+		h.Flags |= 0b0000_0001
+	} else {
+		h.Flags &^= 0b0000_0001
+	}
+}
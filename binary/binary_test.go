@@ -7,6 +7,8 @@ import (
 	"io"
 	"reflect"
 	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
 )
 
 func TestRead(t *testing.T) {
@@ -58,6 +60,65 @@ func TestRead(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "xy envelope",
+			data: []byte{
+				0x47, 0x50, // magic
+				0x00,                   // version
+				0b0000_0011,            // flags
+				0x01, 0x00, 0x00, 0x00, // srs_id
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f, // minx
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, // maxx
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x40, // miny
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x40, // maxy
+			},
+			want: &Header{
+				HeaderTop: HeaderTop{
+					Magic:   [2]byte{0x47, 0x50},
+					Version: 0,
+					Flags:   0b0000_0011,
+				},
+				HeaderSrs: HeaderSrs{
+					SrsId: 1,
+				},
+				Envelope: Envelope{
+					MinX: 1, MaxX: 2, MinY: 3, MaxY: 4,
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "xyzm envelope",
+			data: []byte{
+				0x47, 0x50, // magic
+				0x00,                   // version
+				0b0000_1000,            // flags
+				0x00, 0x00, 0x00, 0x01, // srs_id
+				0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // minx
+				0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // maxx
+				0x40, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // miny
+				0x40, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // maxy
+				0x40, 0x14, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // minz
+				0x40, 0x18, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // maxz
+				0x40, 0x1c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // minm
+				0x40, 0x20, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // maxm
+			},
+			want: &Header{
+				HeaderTop: HeaderTop{
+					Magic:   [2]byte{0x47, 0x50},
+					Version: 0,
+					Flags:   0b0000_1000,
+				},
+				HeaderSrs: HeaderSrs{
+					SrsId: 1,
+				},
+				Envelope: Envelope{
+					MinX: 1, MaxX: 2, MinY: 3, MaxY: 4,
+					MinZ: 5, MaxZ: 6, MinM: 7, MaxM: 8,
+				},
+			},
+			wantErr: nil,
+		},
 		{
 			name: "eof",
 			data: []byte{
@@ -106,6 +167,147 @@ func TestRead(t *testing.T) {
 	}
 }
 
+func TestParseHeader(t *testing.T) {
+	headers := []*Header{
+		{
+			HeaderTop: HeaderTop{Magic: [2]byte{0x47, 0x50}},
+			HeaderSrs: HeaderSrs{SrsId: 1},
+		},
+		{
+			HeaderTop: HeaderTop{Magic: [2]byte{0x47, 0x50}, Flags: 0b0010_0011},
+			HeaderSrs: HeaderSrs{SrsId: 4326},
+			Envelope:  Envelope{MinX: 1, MaxX: 2, MinY: 3, MaxY: 4},
+			ExtensionCode: []byte{
+				'T', 'W', 'K', 'B',
+			},
+		},
+		{
+			HeaderTop: HeaderTop{Magic: [2]byte{0x47, 0x50}, Flags: 0b0000_1000},
+			HeaderSrs: HeaderSrs{SrsId: -1},
+			Envelope:  Envelope{MinX: 1, MaxX: 2, MinY: 3, MaxY: 4, MinZ: 5, MaxZ: 6, MinM: 7, MaxM: 8},
+		},
+	}
+	for _, h := range headers {
+		var buf bytes.Buffer
+		if err := h.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		n := buf.Len()
+		buf.WriteString("payload")
+		b := buf.Bytes()
+
+		got, off, err := ParseHeader(b)
+		if err != nil {
+			t.Fatalf("ParseHeader() error = %v", err)
+		}
+		if off != n {
+			t.Errorf("ParseHeader() offset = %d, want %d", off, n)
+		}
+		want, err := Read(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&got, want) {
+			t.Errorf("ParseHeader() = %v, want %v", &got, want)
+		}
+	}
+
+	errs := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"eof", []byte{0x47, 0x50, 0x00}, io.ErrUnexpectedEOF},
+		{"invalid magic", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, ErrInvalidMagic},
+		{"short envelope", []byte{0x47, 0x50, 0x00, 0b0000_0010, 0x00, 0x00, 0x00, 0x01, 0x00}, io.ErrUnexpectedEOF},
+		{"short extension code", []byte{0x47, 0x50, 0x00, 0b0010_0000, 0x00, 0x00, 0x00, 0x01, 'T', 'W'}, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseHeader(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseHeader() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseHeader_Allocs(t *testing.T) {
+	b := []byte{
+		0x47, 0x50, // magic
+		0x00,                   // version
+		0b0010_0011,            // flags
+		0xE6, 0x10, 0x00, 0x00, // srs_id
+		0, 0, 0, 0, 0, 0, 0xF0, 0x3F, // minx
+		0, 0, 0, 0, 0, 0, 0x00, 0x40, // maxx
+		0, 0, 0, 0, 0, 0, 0xF0, 0xBF, // miny
+		0, 0, 0, 0, 0, 0, 0xE0, 0x3F, // maxy
+		'T', 'W', 'K', 'B',
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		h, _, err := ParseHeader(b)
+		if err != nil || !h.ContainsXY(1.5, 0) {
+			t.Fatal("unexpected header")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ParseHeader() allocates %v times, want 0", allocs)
+	}
+}
+
+func BenchmarkParseHeader(b *testing.B) {
+	h := &Header{
+		HeaderTop: HeaderTop{Magic: [2]byte{0x47, 0x50}, Flags: 0b0010_0011},
+		Envelope:  Envelope{MinX: 1, MaxX: 2, MinY: 3, MaxY: 4},
+		ExtensionCode: []byte{
+			'T', 'W', 'K', 'B',
+		},
+	}
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	b.Run("ParseHeader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := ParseHeader(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Read", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := Read(bytes.NewReader(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestEnvelope_ContainsXY(t *testing.T) {
+	e := Envelope{MinX: 1, MaxX: 2, MinY: 3, MaxY: 4}
+	tests := []struct {
+		name string
+		x, y float64
+		want bool
+	}{
+		{"inside", 1.5, 3.5, true},
+		{"corner", 1, 3, true},
+		{"left", 0.5, 3.5, false},
+		{"above", 1.5, 4.5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.ContainsXY(tt.x, tt.y); got != tt.want {
+				t.Errorf("Envelope.ContainsXY() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestBinary_Write(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -158,7 +360,7 @@ func TestBinary_Write(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "unsupported envelope",
+			name: "xy envelope",
 			b: &Header{
 				HeaderTop: HeaderTop{
 					Magic:   [2]byte{0x47, 0x50},
@@ -168,6 +370,58 @@ func TestBinary_Write(t *testing.T) {
 				HeaderSrs: HeaderSrs{
 					SrsId: 1,
 				},
+				Envelope: Envelope{MinX: 1, MaxX: 2, MinY: -1, MaxY: 0.5},
+			},
+			want: []byte{
+				0x47, 0x50, // magic
+				0x00,                   // version
+				0b0000_0010,            // flags
+				0x00, 0x00, 0x00, 0x01, // srs_id
+				0x3F, 0xF0, 0, 0, 0, 0, 0, 0, // minx
+				0x40, 0x00, 0, 0, 0, 0, 0, 0, // maxx
+				0xBF, 0xF0, 0, 0, 0, 0, 0, 0, // miny
+				0x3F, 0xE0, 0, 0, 0, 0, 0, 0, // maxy
+			},
+			wantErr: false,
+		},
+		{
+			name: "xym envelope little endian",
+			b: &Header{
+				HeaderTop: HeaderTop{
+					Magic:   [2]byte{0x47, 0x50},
+					Version: 0,
+					Flags:   0b0000_0111,
+				},
+				HeaderSrs: HeaderSrs{
+					SrsId: 1,
+				},
+				Envelope: Envelope{MinX: 1, MaxX: 2, MinY: -1, MaxY: 0.5, MinZ: 9, MaxZ: 9, MinM: 2, MaxM: 1},
+			},
+			want: []byte{
+				0x47, 0x50, // magic
+				0x00,                   // version
+				0b0000_0111,            // flags
+				0x01, 0x00, 0x00, 0x00, // srs_id
+				0, 0, 0, 0, 0, 0, 0xF0, 0x3F, // minx
+				0, 0, 0, 0, 0, 0, 0x00, 0x40, // maxx
+				0, 0, 0, 0, 0, 0, 0xF0, 0xBF, // miny
+				0, 0, 0, 0, 0, 0, 0xE0, 0x3F, // maxy
+				0, 0, 0, 0, 0, 0, 0x00, 0x40, // minm
+				0, 0, 0, 0, 0, 0, 0xF0, 0x3F, // maxm
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid envelope",
+			b: &Header{
+				HeaderTop: HeaderTop{
+					Magic:   [2]byte{0x47, 0x50},
+					Version: 0,
+					Flags:   0b0000_1010,
+				},
+				HeaderSrs: HeaderSrs{
+					SrsId: 1,
+				},
 			},
 			want:    nil,
 			wantErr: true,
@@ -237,6 +491,86 @@ func TestBinaryReadWrite(t *testing.T) {
 	}
 }
 
+func TestEnvelopeReadWrite(t *testing.T) {
+	for _, c := range []EnvelopeContentsIndicatorCode{NoEnvelope, XY, XYZ, XYM, XYZM} {
+		for _, flags := range []uint8{0, 1} {
+			h := &Header{
+				HeaderTop: HeaderTop{
+					Magic: [2]byte{0x47, 0x50},
+					Flags: flags,
+				},
+				HeaderSrs: HeaderSrs{
+					SrsId: 4326,
+				},
+			}
+			h.SetEnvelopeContentsIndicatorCode(c)
+			e := Envelope{MinX: 1, MaxX: 2, MinY: 3, MaxY: 4}
+			if c == XYZ || c == XYZM {
+				e.MinZ, e.MaxZ = 5, 6
+			}
+			if c == XYM || c == XYZM {
+				e.MinM, e.MaxM = 7, 8
+			}
+			if c != NoEnvelope {
+				h.Envelope = e
+			}
+
+			var buf bytes.Buffer
+			if err := h.Write(&buf); err != nil {
+				t.Fatalf("%d: unexpected error writing: %v", c, err)
+			}
+			if got, want := buf.Len(), 8+c.Size(); got != want {
+				t.Errorf("%d: got %d bytes, want %d", c, got, want)
+			}
+			got, err := Read(&buf)
+			if err != nil {
+				t.Fatalf("%d: unexpected error reading: %v", c, err)
+			}
+			if !reflect.DeepEqual(h, got) {
+				t.Errorf("%d: expected %v, but got %v", c, h, got)
+			}
+		}
+	}
+}
+
+func TestEnvelopeOf(t *testing.T) {
+	tests := []struct {
+		wkt      string
+		want     Envelope
+		wantCode EnvelopeContentsIndicatorCode
+	}{
+		{"POINT EMPTY", Envelope{}, NoEnvelope},
+		{"POLYGON EMPTY", Envelope{}, NoEnvelope},
+		{"POINT(1 2)", Envelope{MinX: 1, MaxX: 1, MinY: 2, MaxY: 2}, XY},
+		{"LINESTRING(3 -1,1 2)", Envelope{MinX: 1, MaxX: 3, MinY: -1, MaxY: 2}, XY},
+		{"LINESTRING Z(0 0 5,1 1 -5)", Envelope{MinX: 0, MaxX: 1, MinY: 0, MaxY: 1, MinZ: -5, MaxZ: 5}, XYZ},
+		{"LINESTRING M(0 0 5,1 1 -5)", Envelope{MinX: 0, MaxX: 1, MinY: 0, MaxY: 1, MinM: -5, MaxM: 5}, XYM},
+		{"MULTIPOINT ZM(0 0 1 2,1 1 3 4)", Envelope{MinX: 0, MaxX: 1, MinY: 0, MaxY: 1, MinZ: 1, MaxZ: 3, MinM: 2, MaxM: 4}, XYZM},
+		{"GEOMETRYCOLLECTION(POINT(5 5),POLYGON((0 0,1 0,1 1,0 0)))", Envelope{MinX: 0, MaxX: 5, MinY: 0, MaxY: 5}, XY},
+	}
+	for _, tt := range tests {
+		t.Run(tt.wkt, func(t *testing.T) {
+			g, err := geom.UnmarshalWKT(tt.wkt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, code := EnvelopeOf(g)
+			if code != tt.wantCode {
+				t.Errorf("EnvelopeOf() code = %d, want %d", code, tt.wantCode)
+			}
+			if got != tt.want {
+				t.Errorf("EnvelopeOf() = %v, want %v", got, tt.want)
+			}
+
+			h := &Header{}
+			h.SetEnvelope(g)
+			if h.EnvelopeContentsIndicatorCode() != tt.wantCode || h.Envelope != tt.want {
+				t.Errorf("SetEnvelope() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
 func TestHeaderTop_Type(t *testing.T) {
 	tests := []struct {
 		name string
@@ -552,3 +886,177 @@ func TestHeaderTop_ByteOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestHeaderTop_SetEmpty(t *testing.T) {
+	tests := []struct {
+		name  string
+		h     HeaderTop
+		empty bool
+		want  HeaderTop
+	}{
+		{
+			name: "set empty",
+			h: HeaderTop{
+				Flags: 0b0010_0001,
+			},
+			empty: true,
+			want: HeaderTop{
+				Flags: 0b0011_0001,
+			},
+		},
+		{
+			name: "clear empty",
+			h: HeaderTop{
+				Flags: 0b0011_0001,
+			},
+			empty: false,
+			want: HeaderTop{
+				Flags: 0b0010_0001,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.h.SetEmpty(tt.empty)
+			if !reflect.DeepEqual(tt.h, tt.want) {
+				t.Errorf("HeaderTop.SetEmpty() = %v, want %v", tt.h, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderTop_SetByteOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		h    HeaderTop
+		bo   binary.ByteOrder
+		want HeaderTop
+	}{
+		{
+			name: "set little endian",
+			h: HeaderTop{
+				Flags: 0b0000_0010,
+			},
+			bo: binary.LittleEndian,
+			want: HeaderTop{
+				Flags: 0b0000_0011,
+			},
+		},
+		{
+			name: "set big endian",
+			h: HeaderTop{
+				Flags: 0b0000_0011,
+			},
+			bo: binary.BigEndian,
+			want: HeaderTop{
+				Flags: 0b0000_0010,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.h.SetByteOrder(tt.bo)
+			if !reflect.DeepEqual(tt.h, tt.want) {
+				t.Errorf("HeaderTop.SetByteOrder() = %v, want %v", tt.h, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeader_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       HeaderTop
+		wantErr error
+	}{
+		{"valid", HeaderTop{Flags: 0b0010_1001}, nil},
+		{"version", HeaderTop{Version: 1}, ErrInvalidVersion},
+		{"envelope 5", HeaderTop{Flags: 0b0000_1010}, ErrInvalidEnvelope},
+		{"envelope 7", HeaderTop{Flags: 0b0000_1110}, ErrInvalidEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Header{HeaderTop: tt.h}
+			if err := h.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Header.Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeader_ValidateGeometry(t *testing.T) {
+	empty, err := geom.UnmarshalWKT("POLYGON EMPTY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	point, err := geom.UnmarshalWKT("POINT(1 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		flags   uint8
+		g       geom.Geometry
+		wantErr error
+	}{
+		{"empty", 0b0001_0000, empty, nil},
+		{"not empty", 0, point, nil},
+		{"flag without empty geometry", 0b0001_0000, point, ErrInconsistentEmpty},
+		{"empty geometry without flag", 0, empty, ErrInconsistentEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Header{HeaderTop: HeaderTop{Flags: tt.flags}}
+			if err := h.ValidateGeometry(tt.g); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Header.ValidateGeometry() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHeader_ValidateEnvelope(t *testing.T) {
+	point, err := geom.UnmarshalWKT("POINT(1.23456 -2.34567)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	twkb, err := geom.MarshalTWKB(point, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rounded, err := geom.UnmarshalTWKB(twkb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exact := Envelope{MinX: 1.23456, MaxX: 1.23456, MinY: -2.34567, MaxY: -2.34567}
+	tests := []struct {
+		name     string
+		extended bool
+		code     EnvelopeContentsIndicatorCode
+		env      Envelope
+		g        geom.Geometry
+		payload  []byte
+		wantErr  error
+	}{
+		{"no envelope", false, NoEnvelope, Envelope{}, point, point.AsBinary(), nil},
+		{"in envelope", false, XY, exact, point, point.AsBinary(), nil},
+		{"outside envelope", false, XY, Envelope{MinX: 0, MaxX: 1, MinY: -3, MaxY: 0}, point, point.AsBinary(), ErrOutsideEnvelope},
+		{"rounded twkb", true, XY, exact, rounded, twkb, nil},
+		{"rounded wkb", false, XY, exact, rounded, rounded.AsBinary(), ErrOutsideEnvelope},
+		{"outside twkb", true, XY, Envelope{MinX: 0, MaxX: 1, MinY: -3, MaxY: 0}, rounded, twkb, ErrOutsideEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Header{Envelope: tt.env}
+			h.SetEnvelopeContentsIndicatorCode(tt.code)
+			if tt.extended {
+				h.SetType(ExtendedType)
+				h.ExtensionCode = ExtensionTWKB
+			}
+			if err := h.ValidateEnvelope(tt.g, tt.payload); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Header.ValidateEnvelope() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
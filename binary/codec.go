@@ -0,0 +1,120 @@
+package binary
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// Decoder decodes the payload of an extended geometry blob.
+//
+// The payload is only valid for the duration of the Decode call, as
+// callers such as the gpkg package reuse its buffer for the next blob.
+// Decoders must not retain it or any slice of it.
+type Decoder interface {
+	Decode(payload []byte, opts ...geom.ConstructorOption) (geom.Geometry, error)
+}
+
+// Encoder encodes a geometry into the payload of an extended geometry blob,
+// appending it to dst
+type Encoder interface {
+	Encode(dst []byte, g geom.Geometry) ([]byte, error)
+}
+
+// DecoderFunc adapts a function to a Decoder
+type DecoderFunc func(payload []byte, opts ...geom.ConstructorOption) (geom.Geometry, error)
+
+func (f DecoderFunc) Decode(payload []byte, opts ...geom.ConstructorOption) (geom.Geometry, error) {
+	return f(payload, opts...)
+}
+
+// EncoderFunc adapts a function to an Encoder
+type EncoderFunc func(dst []byte, g geom.Geometry) ([]byte, error)
+
+func (f EncoderFunc) Encode(dst []byte, g geom.Geometry) ([]byte, error) {
+	return f(dst, g)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	decoders map[[4]byte]Decoder
+	encoders map[[4]byte]Encoder
+}{
+	decoders: map[[4]byte]Decoder{},
+	encoders: map[[4]byte]Encoder{},
+}
+
+func init() {
+	RegisterDecoder(ExtensionTWKB, DecoderFunc(geom.UnmarshalTWKB))
+}
+
+// RegisterDecoder registers the decoder used by Unmarshal for extended
+// geometry blobs with the 4-byte extension code, replacing any decoder
+// previously registered for it. It panics if the code is not 4 bytes long
+// or d is nil.
+//
+// The decoder must not retain the payload passed to it, see Decoder.
+func RegisterDecoder(code []byte, d Decoder) {
+	key := codecKey(code)
+	if d == nil {
+		panic("binary: RegisterDecoder decoder is nil")
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.decoders[key] = d
+}
+
+// RegisterEncoder registers the encoder used by MarshalExtended for the
+// 4-byte extension code, replacing any encoder previously registered for
+// it. It panics if the code is not 4 bytes long or e is nil.
+func RegisterEncoder(code []byte, e Encoder) {
+	key := codecKey(code)
+	if e == nil {
+		panic("binary: RegisterEncoder encoder is nil")
+	}
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.encoders[key] = e
+}
+
+// LookupDecoder returns the decoder registered for the extension code
+func LookupDecoder(code []byte) (Decoder, bool) {
+	if len(code) != 4 {
+		return nil, false
+	}
+	codecs.RLock()
+	defer codecs.RUnlock()
+	d, ok := codecs.decoders[[4]byte(code)]
+	return d, ok
+}
+
+// LookupEncoder returns the encoder registered for the extension code
+func LookupEncoder(code []byte) (Encoder, bool) {
+	if len(code) != 4 {
+		return nil, false
+	}
+	codecs.RLock()
+	defer codecs.RUnlock()
+	e, ok := codecs.encoders[[4]byte(code)]
+	return e, ok
+}
+
+// TWKBEncoder returns an Encoder writing TWKB with precXY decimal digits
+// of precision, for registering under ExtensionTWKB
+func TWKBEncoder(precXY int) Encoder {
+	return EncoderFunc(func(dst []byte, g geom.Geometry) ([]byte, error) {
+		b, err := geom.MarshalTWKB(g, precXY)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, b...), nil
+	})
+}
+
+func codecKey(code []byte) [4]byte {
+	if len(code) != 4 {
+		panic(fmt.Sprintf("binary: invalid extension code length %d", len(code)))
+	}
+	return [4]byte(code)
+}
@@ -0,0 +1,101 @@
+package binary
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// extensionFlate is a test extension storing flate compressed WKB
+var extensionFlate = []byte{'F', 'W', 'K', 'B'}
+
+// registerFlate registers the codecs of extensionFlate for the duration
+// of the test
+func registerFlate(t *testing.T) {
+	t.Helper()
+	RegisterDecoder(extensionFlate, DecoderFunc(func(payload []byte, opts ...geom.ConstructorOption) (geom.Geometry, error) {
+		b, err := io.ReadAll(flate.NewReader(bytes.NewReader(payload)))
+		if err != nil {
+			return geom.Geometry{}, err
+		}
+		return geom.UnmarshalWKB(b, opts...)
+	}))
+	RegisterEncoder(extensionFlate, EncoderFunc(func(dst []byte, g geom.Geometry) ([]byte, error) {
+		buf := bytes.NewBuffer(dst)
+		w, err := flate.NewWriter(buf, flate.BestCompression)
+		if err != nil {
+			return dst, err
+		}
+		if _, err := w.Write(g.AsBinary()); err != nil {
+			return dst, err
+		}
+		if err := w.Close(); err != nil {
+			return dst, err
+		}
+		return buf.Bytes(), nil
+	}))
+	t.Cleanup(func() {
+		codecs.Lock()
+		defer codecs.Unlock()
+		delete(codecs.decoders, [4]byte(extensionFlate))
+		delete(codecs.encoders, [4]byte(extensionFlate))
+	})
+}
+
+func TestRegisteredCodec(t *testing.T) {
+	registerFlate(t)
+	g, err := geom.UnmarshalWKT("POLYGON((0 0,1 0,1 1,0 1,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MarshalExtended(4326, g, extensionFlate)
+	if err != nil {
+		t.Fatalf("MarshalExtended() error = %v", err)
+	}
+	h, got, err := Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !bytes.Equal(h.ExtensionCode, extensionFlate) {
+		t.Errorf("got extension code %q, want %q", h.ExtensionCode, extensionFlate)
+	}
+	if h.EnvelopeContentsIndicatorCode() != XY {
+		t.Errorf("got envelope code %d, want %d", h.EnvelopeContentsIndicatorCode(), XY)
+	}
+	if !geom.ExactEquals(got, g) {
+		t.Errorf("got %s, want %s", got.AsText(), g.AsText())
+	}
+}
+
+func TestUnregisteredCodec(t *testing.T) {
+	code := []byte{'N', 'O', 'P', 'E'}
+	g, err := geom.UnmarshalWKT("POINT(1 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarshalExtended(4326, g, code); !errors.Is(err, ErrUnsupportedGeometry) {
+		t.Errorf("MarshalExtended() error = %v, want ErrUnsupportedGeometry", err)
+	}
+	if _, ok := LookupDecoder(code); ok {
+		t.Error("LookupDecoder() found unregistered code")
+	}
+	if _, ok := LookupEncoder(ExtensionTWKB); ok {
+		t.Error("LookupEncoder() found TWKB encoder, which is not registered by default")
+	}
+	if _, ok := LookupDecoder(ExtensionTWKB); !ok {
+		t.Error("LookupDecoder() did not find the default TWKB decoder")
+	}
+}
+
+func TestRegisterDecoder_InvalidCode(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterDecoder() did not panic for a 3 byte code")
+		}
+	}()
+	RegisterDecoder([]byte{'B', 'A', 'D'}, DecoderFunc(geom.UnmarshalWKB))
+}
@@ -0,0 +1,133 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+var ErrUnsupportedGeometry = errors.New("unsupported geometry type")
+
+// Unmarshal decodes a GeoPackage geometry blob into its header and
+// geometry. Standard blobs are decoded as WKB and extended blobs with the
+// Decoder registered for their extension code, by default only TWKB. An
+// empty blob without a payload decodes to the zero geometry.
+func Unmarshal(b []byte, opts ...geom.ConstructorOption) (*Header, geom.Geometry, error) {
+	h, n, err := ParseHeader(b)
+	if err != nil {
+		return nil, geom.Geometry{}, err
+	}
+	g, err := UnmarshalPayload(&h, b[n:], opts...)
+	return &h, g, err
+}
+
+// UnmarshalPayload decodes the payload following the header h of a
+// GeoPackage geometry blob, like Unmarshal.
+func UnmarshalPayload(h *Header, payload []byte, opts ...geom.ConstructorOption) (geom.Geometry, error) {
+	var g geom.Geometry
+	if h.Empty() && len(payload) == 0 {
+		return g, nil
+	}
+	switch h.Type() {
+	case StandardType:
+		return geom.UnmarshalWKB(payload, opts...)
+	case ExtendedType:
+		d, ok := LookupDecoder(h.ExtensionCode)
+		if !ok {
+			return g, fmt.Errorf("%w: extension %q", ErrUnsupportedGeometry, h.ExtensionCode)
+		}
+		return d.Decode(payload, opts...)
+	default:
+		return g, ErrUnsupportedGeometry
+	}
+}
+
+// Marshal encodes g as a standard GeoPackage geometry blob with a little
+// endian header, the envelope of g and a WKB payload.
+func Marshal(srsId int32, g geom.Geometry) ([]byte, error) {
+	h := NewHeader(srsId, g)
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		return nil, err
+	}
+	return g.AppendWKB(buf.Bytes()), nil
+}
+
+// MarshalTWKB encodes g as an extended GeoPackage geometry blob with the
+// ExtensionTWKB code and a TWKB payload with precXY decimal digits of
+// precision. TWKB truncates the coordinates towards zero, so the envelope
+// is truncated the same way to contain the geometry as it is decoded.
+func MarshalTWKB(srsId int32, g geom.Geometry, precXY int) ([]byte, error) {
+	payload, err := geom.MarshalTWKB(g, precXY)
+	if err != nil {
+		return nil, err
+	}
+	h := NewHeader(srsId, g)
+	// Truncating preserves the order of the coordinates, and Z and M use
+	// the XY precision by default
+	e := &h.Envelope
+	for _, v := range []*float64{&e.MinX, &e.MaxX, &e.MinY, &e.MaxY, &e.MinZ, &e.MaxZ, &e.MinM, &e.MaxM} {
+		*v = truncate(*v, precXY)
+	}
+	return marshalExtended(h, ExtensionTWKB, payload)
+}
+
+// truncate returns v as it is decoded from TWKB with the precision
+func truncate(v float64, precision int) float64 {
+	return float64(int64(v*math.Pow10(precision))) * math.Pow10(-precision)
+}
+
+// MarshalExtended encodes g as an extended GeoPackage geometry blob with
+// the extension code and a payload written by the Encoder registered for it.
+// Encoders may round the coordinates, so if a Decoder is registered for the
+// code too, the envelope is the one of the geometry it decodes.
+func MarshalExtended(srsId int32, g geom.Geometry, code []byte) ([]byte, error) {
+	e, ok := LookupEncoder(code)
+	if !ok {
+		return nil, fmt.Errorf("%w: extension %q", ErrUnsupportedGeometry, code)
+	}
+	payload, err := e.Encode(nil, g)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := LookupDecoder(code); ok {
+		g, err = d.Decode(payload, geom.DisableAllValidations)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return marshalExtended(NewHeader(srsId, g), code, payload)
+}
+
+// marshalExtended writes the header h as an extended header with the
+// extension code followed by the payload
+func marshalExtended(h *Header, code []byte, payload []byte) ([]byte, error) {
+	h.SetType(ExtendedType)
+	h.ExtensionCode = code
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		return nil, err
+	}
+	return append(buf.Bytes(), payload...), nil
+}
+
+// NewHeader returns a little endian standard header for g with the
+// given SRS id, the envelope of g and the empty flag set if g is empty.
+func NewHeader(srsId int32, g geom.Geometry) *Header {
+	h := &Header{
+		HeaderTop: HeaderTop{
+			Magic: [2]byte{0x47, 0x50},
+		},
+		HeaderSrs: HeaderSrs{
+			SrsId: srsId,
+		},
+	}
+	h.SetByteOrder(binary.LittleEndian)
+	h.SetEmpty(g.IsEmpty())
+	h.SetEnvelope(g)
+	return h
+}
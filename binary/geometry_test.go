@@ -0,0 +1,165 @@
+package binary
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func TestMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		wkt      string
+		wantCode EnvelopeContentsIndicatorCode
+	}{
+		{"point", "POINT(1 2)", XY},
+		{"point z", "POINT Z(1 2 3)", XYZ},
+		{"line m", "LINESTRING M(0 0 1,1 1 2)", XYM},
+		{"polygon zm", "POLYGON ZM((0 0 1 2,1 0 1 2,1 1 1 2,0 0 1 2))", XYZM},
+		{"multipolygon", "MULTIPOLYGON(((0 0,1 0,1 1,0 0)),((5 5,6 5,6 6,5 5)))", XY},
+		{"empty polygon", "POLYGON EMPTY", NoEnvelope},
+		{"empty collection", "GEOMETRYCOLLECTION EMPTY", NoEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := geom.UnmarshalWKT(tt.wkt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := Marshal(4326, g)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			h, got, err := Unmarshal(b)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if h.SrsId != 4326 {
+				t.Errorf("got srs id %d, want 4326", h.SrsId)
+			}
+			if h.Type() != StandardType {
+				t.Errorf("got type %s, want %s", h.Type(), StandardType)
+			}
+			if h.Empty() != g.IsEmpty() {
+				t.Errorf("got empty %v, want %v", h.Empty(), g.IsEmpty())
+			}
+			if h.EnvelopeContentsIndicatorCode() != tt.wantCode {
+				t.Errorf("got envelope code %d, want %d", h.EnvelopeContentsIndicatorCode(), tt.wantCode)
+			}
+			if !geom.ExactEquals(got, g) {
+				t.Errorf("got %s, want %s", got.AsText(), g.AsText())
+			}
+
+			b, err = MarshalTWKB(4326, g, 3)
+			if err != nil {
+				t.Fatalf("MarshalTWKB() error = %v", err)
+			}
+			h, got, err = Unmarshal(b)
+			if err != nil {
+				t.Fatalf("Unmarshal() TWKB error = %v", err)
+			}
+			if h.Type() != ExtendedType || !bytes.Equal(h.ExtensionCode, ExtensionTWKB) {
+				t.Errorf("got type %s %q, want TWKB extension", h.Type(), h.ExtensionCode)
+			}
+			if !geom.ExactEquals(got, g) {
+				t.Errorf("got TWKB %s, want %s", got.AsText(), g.AsText())
+			}
+		})
+	}
+}
+
+func TestMarshalTWKB_Envelope(t *testing.T) {
+	tests := []struct {
+		wkt  string
+		prec int
+	}{
+		{"POLYGON((1.23456 1.23456,3.45678 1.23456,3.45678 3.45678,1.23456 1.23456))", 3},
+		{"POLYGON((0.12345 -0.98765,1.55555 -0.98765,1.55555 2.44449,0.12345 -0.98765))", 3},
+		{"LINESTRING(-12.3456 45.6789,-12.3 45.7)", 1},
+		{"POINT Z(1.234 -5.678 9.87)", 2},
+		{"MULTIPOINT((149 51),(151 -49))", -2},
+		{"POLYGON EMPTY", 3},
+	}
+	for _, tt := range tests {
+		g, err := geom.UnmarshalWKT(tt.wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		marshal := map[string]func() ([]byte, error){
+			"MarshalTWKB": func() ([]byte, error) {
+				return MarshalTWKB(4326, g, tt.prec)
+			},
+			"MarshalExtended": func() ([]byte, error) {
+				RegisterEncoder(ExtensionTWKB, TWKBEncoder(tt.prec))
+				defer func() {
+					codecs.Lock()
+					defer codecs.Unlock()
+					delete(codecs.encoders, [4]byte(ExtensionTWKB))
+				}()
+				return MarshalExtended(4326, g, ExtensionTWKB)
+			},
+		}
+		for name, fn := range marshal {
+			b, err := fn()
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tt.wkt, err)
+			}
+			h, n, err := ParseHeader(b)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tt.wkt, err)
+			}
+			got, err := UnmarshalPayload(&h, b[n:], geom.DisableAllValidations)
+			if err != nil {
+				t.Fatalf("%s %s: %v", name, tt.wkt, err)
+			}
+			want, code := EnvelopeOf(got)
+			if h.EnvelopeContentsIndicatorCode() != code || h.Envelope != want {
+				t.Errorf("%s %s: got envelope %v, want %v of %s", name, tt.wkt, h.Envelope, want, got.AsText())
+			}
+		}
+	}
+}
+
+func TestMarshal_Bytes(t *testing.T) {
+	g, err := geom.UnmarshalWKT("POINT(1 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Marshal(4326, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x47, 0x50, // magic
+		0x00,                   // version
+		0b0000_0011,            // flags, little endian, xy envelope
+		0xE6, 0x10, 0x00, 0x00, // srs_id
+	}
+	if !bytes.Equal(b[:8], want) {
+		t.Errorf("got header %v, want %v", b[:8], want)
+	}
+	if got, want := len(b), 8+XY.Size()+21; got != want {
+		t.Errorf("got %d bytes, want %d", got, want)
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"invalid magic", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"truncated", []byte{0x47, 0x50, 0x00}},
+		{"unknown extension", []byte{0x47, 0x50, 0x00, 0b0010_0001, 0x00, 0x00, 0x00, 0x00, 'Z', 'S', 'T', 'D', 0x00}},
+		{"invalid payload", []byte{0x47, 0x50, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := Unmarshal(tt.b); err == nil {
+				t.Error("Unmarshal() expected error")
+			}
+		})
+	}
+}
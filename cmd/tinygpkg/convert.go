@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/smilyorg/tinygpkg/writer"
+)
+
+// convert converts the WKB geometries of a GeoPackage to TWKB and prints
+// the sizes before and after
+func convert(args []string, w io.Writer) error {
+	fs := newFlagSet("convert", "convert [flags] <file> [output]")
+	precision := fs.Int("precision", 3, "decimal digits of the XY coordinates to keep")
+	table := fs.String("table", "", "feature table to convert, all if empty")
+	if err := parse(fs, args, 1, 2); err != nil {
+		return err
+	}
+	opts := writer.ConvertOptions{Precision: precision}
+	if *table != "" {
+		opts.Tables = []string{*table}
+	}
+	stats, err := writer.Convert(fs.Arg(0), fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "converted %d geometries\n", stats.Features)
+	fmt.Fprintf(w, "geometries: %s -> %s (%s)\n",
+		byteSize(stats.BlobsBefore), byteSize(stats.BlobsAfter), ratio(stats.BlobsBefore, stats.BlobsAfter))
+	fmt.Fprintf(w, "file: %s -> %s (%s)\n",
+		byteSize(stats.FileBefore), byteSize(stats.FileAfter), ratio(stats.FileBefore, stats.FileAfter))
+	return nil
+}
+
+// byteSize formats n bytes with a binary unit
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ratio formats the size after as a percentage of the size before
+func ratio(before, after int64) string {
+	if before == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(after)/float64(before)*100)
+}
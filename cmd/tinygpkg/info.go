@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// info prints the feature tables of a GeoPackage with their spatial
+// reference system, feature count and geometry encodings, and the
+// registered extensions
+func info(args []string, w io.Writer) error {
+	fs := newFlagSet("info", "info <file>")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	conn, err := openConn(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cols, err := geometryColumns(conn, "")
+	if err != nil {
+		return err
+	}
+	for _, c := range cols {
+		srs := ""
+		err := sqlitex.Execute(conn, `
+			SELECT organization || ':' || organization_coordsys_id || ' ' || srs_name
+			FROM gpkg_spatial_ref_sys
+			WHERE srs_id = ?`, &sqlitex.ExecOptions{
+			Args: []any{c.srsId},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				srs = stmt.ColumnText(0)
+				return nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if srs == "" {
+			srs = "undefined"
+		}
+
+		encodings, count, err := geometryEncodings(conn, c)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", c.table, err)
+		}
+
+		fmt.Fprintf(w, "table %s\n", c.table)
+		fmt.Fprintf(w, "  geometry: %s %s\n", c.column, c.typ)
+		fmt.Fprintf(w, "  srs: %d (%s)\n", c.srsId, srs)
+		fmt.Fprintf(w, "  features: %d\n", count)
+		names := make([]string, 0, len(encodings))
+		for name := range encodings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  encoding %s: %d\n", name, encodings[name])
+		}
+	}
+
+	exists := false
+	err = sqlitex.Execute(conn, `
+		SELECT 1
+		FROM sqlite_master
+		WHERE type = 'table' AND name = 'gpkg_extensions'`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			exists = true
+			return nil
+		},
+	})
+	if err != nil || !exists {
+		return err
+	}
+	fmt.Fprintln(w, "extensions")
+	return sqlitex.Execute(conn, `
+		SELECT
+			ifnull(table_name, '') ||
+			ifnull('.' || column_name, '') ||
+			CASE WHEN table_name IS NULL THEN '' ELSE ' ' END ||
+			extension_name || ' (' || scope || ')'
+		FROM gpkg_extensions
+		ORDER BY table_name, column_name, extension_name`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			fmt.Fprintf(w, "  %s\n", stmt.ColumnText(0))
+			return nil
+		},
+	})
+}
+
+// geometryEncodings returns the number of geometries of the column by
+// encoding, "WKB" for standard blobs, the extension code for extended
+// blobs, "empty" and "null", and the total number of features
+func geometryEncodings(conn *sqlite.Conn, c geometryColumn) (map[string]int, int, error) {
+	encodings := make(map[string]int)
+	count := 0
+	var buf []byte
+	err := sqlitex.Execute(conn, `
+		SELECT `+sqlutil.QuoteIdent(c.column)+`
+		FROM `+sqlutil.QuoteIdent(c.table), &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			count++
+			if stmt.ColumnType(0) == sqlite.TypeNull {
+				encodings["null"]++
+				return nil
+			}
+			n := stmt.ColumnLen(0)
+			if cap(buf) < n {
+				buf = make([]byte, n)
+			}
+			buf = buf[:n]
+			stmt.ColumnBytes(0, buf)
+			h, _, err := binary.ParseHeader(buf)
+			switch {
+			case err != nil:
+				encodings["invalid"]++
+			case h.Empty():
+				encodings["empty"]++
+			case h.Type() == binary.ExtendedType:
+				encodings[string(h.ExtensionCode)]++
+			default:
+				encodings["WKB"]++
+			}
+			return nil
+		},
+	})
+	return encodings, count, err
+}
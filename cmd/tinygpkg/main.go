@@ -0,0 +1,208 @@
+// Command tinygpkg inspects, queries, converts, validates and serves
+// GeoPackages.
+//
+// Usage:
+//
+//	tinygpkg info <file>
+//	tinygpkg query [-table name] [-columns a,b] [-all] [-distance meters] <file> <lat> <lng>
+//	tinygpkg convert [-precision digits] [-table name] <file> [output]
+//	tinygpkg validate [-table name] <file>
+//	tinygpkg serve [-addr host:port] [-table name] [-columns a,b] [-distance meters] <file>
+//	tinygpkg serve [-addr host:port] -config datasets.json
+//
+// The datasets.json file of serve is a JSON array of server.Dataset
+// objects, whose relative paths are relative to the directory of the file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, w io.Writer) error
+}
+
+var commands = []command{
+	{name: "info", usage: "info <file>", run: info},
+	{name: "query", usage: "query [flags] <file> <lat> <lng>", run: query},
+	{name: "convert", usage: "convert [flags] <file> [output]", run: convert},
+	{name: "validate", usage: "validate [flags] <file>", run: validate},
+	{name: "serve", usage: "serve [flags] [file]", run: serve},
+}
+
+// errUsage is returned for invalid arguments, after the usage is printed
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "tinygpkg:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(args []string, w io.Writer) error {
+	if len(args) > 0 {
+		for _, c := range commands {
+			if c.name == args[0] {
+				return c.run(args[1:], w)
+			}
+		}
+	}
+	fmt.Fprintln(os.Stderr, "usage: tinygpkg <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  tinygpkg", c.usage)
+	}
+	return errUsage
+}
+
+// newFlagSet returns a flag set for the command printing its usage on
+// errors
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: tinygpkg", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags of args and checks that there are between min
+// and max positional arguments
+func parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || fs.NArg() > max {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// usageError prints err and the usage of the command and returns errUsage
+func usageError(fs *flag.FlagSet, err error) error {
+	fmt.Fprintln(fs.Output(), "tinygpkg:", err)
+	fs.Usage()
+	return errUsage
+}
+
+// geometryColumn is a geometry column registered in gpkg_geometry_columns
+type geometryColumn struct {
+	table  string
+	column string
+	typ    string
+	srsId  int32
+}
+
+// openConn opens the GeoPackage at path read-only
+func openConn(path string) (*sqlite.Conn, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return sqlite.OpenConn(path, sqlite.OpenReadOnly)
+}
+
+// geometryColumns returns the geometry columns of the GeoPackage, only
+// those of the table if it is not empty
+func geometryColumns(conn *sqlite.Conn, table string) ([]geometryColumn, error) {
+	var cols []geometryColumn
+	err := sqlitex.Execute(conn, `
+		SELECT table_name, column_name, geometry_type_name, srs_id
+		FROM gpkg_geometry_columns
+		WHERE ? = '' OR table_name = ? COLLATE NOCASE
+		ORDER BY table_name`, &sqlitex.ExecOptions{
+		Args: []any{table, table},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			cols = append(cols, geometryColumn{
+				table:  stmt.ColumnText(0),
+				column: stmt.ColumnText(1),
+				typ:    stmt.ColumnText(2),
+				srsId:  stmt.ColumnInt32(3),
+			})
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		if table != "" {
+			return nil, fmt.Errorf("feature table %s not found", table)
+		}
+		return nil, errors.New("no feature tables found")
+	}
+	return cols, nil
+}
+
+// attributeColumns returns the columns of the table other than its
+// primary key and geometry column
+func attributeColumns(conn *sqlite.Conn, c geometryColumn) ([]string, error) {
+	pk, err := sqlutil.PrimaryKey(conn, c.table)
+	if err != nil {
+		return nil, err
+	}
+	var cols []string
+	err = sqlitex.Execute(conn, `
+		SELECT name
+		FROM pragma_table_info(?)
+		ORDER BY cid`, &sqlitex.ExecOptions{
+		Args: []any{c.table},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			name := stmt.ColumnText(0)
+			if name != pk && !strings.EqualFold(name, c.column) {
+				cols = append(cols, name)
+			}
+			return nil
+		},
+	})
+	return cols, err
+}
+
+// featureTable returns table, or the table gpkg.Open uses for the
+// GeoPackage at path if it is empty
+func featureTable(path, table string) (string, error) {
+	if table != "" {
+		return table, nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return gpkg.DefaultTable(path)
+}
+
+// allColumns returns the attribute columns of the table of the GeoPackage
+// at path
+func allColumns(path, table string) ([]string, error) {
+	conn, err := openConn(path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	gcs, err := geometryColumns(conn, table)
+	if err != nil {
+		return nil, err
+	}
+	return attributeColumns(conn, gcs[0])
+}
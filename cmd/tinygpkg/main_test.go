@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func runOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	err := run(args, &buf)
+	return buf.String(), err
+}
+
+func TestInfo(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	out, err := runOutput(t, "info", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"table places\n",
+		"  srs: 4326 (EPSG:4326 WGS 84 geodetic)\n",
+		"  features: 4\n",
+		"  encoding WKB: 3\n",
+		"  encoding empty: 1\n",
+		"  places.geom gpkg_rtree_index (write-only)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			args: []string{path, "5", "5"},
+			want: "fid: 1\nname: outer\nrank: 1\n",
+		},
+		{
+			args: []string{"-columns", "name", path, "5", "25"},
+			want: "fid: 3\nname: east\n",
+		},
+		{
+			args: []string{"-columns", "name", "-distance", "200000", path, "5", "11"},
+			want: "fid: 1\ndistance: 110771.9\nname: outer\n",
+		},
+	}
+	for _, tt := range tests {
+		out, err := runOutput(t, append([]string{"query"}, tt.args...)...)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if !strings.HasPrefix(out, tt.want) {
+			t.Errorf("%v: got %q, want %q", tt.args, out, tt.want)
+		}
+	}
+
+	if _, err := runOutput(t, "query", path, "5", "15"); err == nil {
+		t.Error("expected error for point outside features")
+	}
+	for _, args := range [][]string{
+		{"north", "15"},
+		{"NaN", "15"},
+		{"5", "+Inf"},
+		{"95", "15"},
+		{"5", "-181"},
+	} {
+		if _, err := runOutput(t, append([]string{"query", path}, args...)...); err != errUsage {
+			t.Errorf("%v: got %v, want %v", args, err, errUsage)
+		}
+	}
+}
+
+func TestConvertValidate(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	dst := filepath.Join(t.TempDir(), "twkb.gpkg")
+	out, err := runOutput(t, "convert", "-precision", "2", path, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "converted 4 geometries\n") {
+		t.Errorf("got %q", out)
+	}
+
+	out, err = runOutput(t, "info", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "  encoding TWKB: 3\n") || !strings.Contains(out, "places.geom tinygpkg_twkb (read-write)") {
+		t.Errorf("got %s", out)
+	}
+
+	out, err = runOutput(t, "validate", dst)
+	if err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if want := "places: 4 features checked\nok\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	conn, err := sqlite.OpenConn(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqlitex.ExecuteScript(conn, `
+		DROP TRIGGER rtree_places_geom_insert;
+		DELETE FROM rtree_places_geom WHERE id = 2;
+		INSERT INTO places (geom, name, rank) VALUES (x'00', 'corrupt', 5);
+	`, nil)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runOutput(t, "validate", path)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		"places: feature 5: unexpected EOF\n",
+		"places: feature 2: not in the spatial index\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "datasets.json")
+	abs := filepath.Join(t.TempDir(), "b.gpkg")
+	config := `[{"name": "a", "path": "data/a.gpkg"}, {"name": "b", "path": ` + strconv.Quote(abs) + `}]`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	datasets, err := readConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "data", "a.gpkg"), abs}
+	for i, d := range datasets {
+		if d.Path != want[i] {
+			t.Errorf("got path %q for dataset %q, want %q", d.Path, d.Name, want[i])
+		}
+	}
+	if len(datasets) != len(want) {
+		t.Errorf("got %d datasets, want %d", len(datasets), len(want))
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if _, err := runOutput(t); err != errUsage {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+	if _, err := runOutput(t, "info"); err != errUsage {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+	if _, err := runOutput(t, "serve", "-config", "datasets.json", "test.gpkg"); err != errUsage {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+}
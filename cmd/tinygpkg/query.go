@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/server"
+)
+
+// query reverse geocodes a point and prints the id and columns of the
+// features found
+func query(args []string, w io.Writer) error {
+	fs := newFlagSet("query", "query [flags] <file> <lat> <lng>")
+	table := fs.String("table", "", "feature table, the first one in gpkg_contents if empty")
+	columns := fs.String("columns", "", "comma-separated columns to print, all if empty")
+	all := fs.Bool("all", false, "print all features containing the point")
+	distance := fs.Float64("distance", 0, "fall back to the nearest feature within this many meters")
+	if err := parse(fs, args, 3, 3); err != nil {
+		return err
+	}
+	lat, err := strconv.ParseFloat(fs.Arg(1), 64)
+	if err != nil {
+		return usageError(fs, fmt.Errorf("invalid latitude: %w", err))
+	}
+	lng, err := strconv.ParseFloat(fs.Arg(2), 64)
+	if err != nil {
+		return usageError(fs, fmt.Errorf("invalid longitude: %w", err))
+	}
+	if err := (server.Point{Lat: lat, Lon: lng}).Validate(); err != nil {
+		return usageError(fs, err)
+	}
+	path := fs.Arg(0)
+	t, err := featureTable(path, *table)
+	if err != nil {
+		return err
+	}
+
+	var cols []string
+	if *columns != "" {
+		cols = strings.Split(*columns, ",")
+	} else {
+		cols, err = allColumns(path, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	g, err := gpkg.Open(path, t, cols)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+	g.MaxDistance = *distance
+
+	ctx := context.Background()
+	l := s2.LatLngFromDegrees(lat, lng)
+	var features []gpkg.Feature
+	if *all {
+		features, err = g.ReverseGeocodeAll(ctx, l)
+	} else {
+		var f gpkg.Feature
+		f, err = g.ReverseGeocodeFeature(ctx, l)
+		features = []gpkg.Feature{f}
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, f := range features {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "fid: %d\n", f.Id)
+		if f.Distance > 0 {
+			fmt.Fprintf(w, "distance: %.1f\n", f.Distance)
+		}
+		for i, col := range f.Columns {
+			fmt.Fprintf(w, "%s: %v\n", col, f.Values[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/smilyorg/tinygpkg/server"
+)
+
+// serve serves reverse geocoding queries over HTTP until interrupted
+func serve(args []string, w io.Writer) error {
+	fs := newFlagSet("serve", "serve [flags] [file]")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	config := fs.String("config", "", "JSON file with an array of datasets, with paths relative to it, instead of a file")
+	table := fs.String("table", "", "feature table of the file, the first one if empty")
+	columns := fs.String("columns", "", "comma-separated columns of the file to return, all if empty")
+	distance := fs.Float64("distance", 0, "fall back to the nearest feature within this many meters")
+	if err := parse(fs, args, 0, 1); err != nil {
+		return err
+	}
+
+	var datasets []server.Dataset
+	switch {
+	case *config != "" && fs.NArg() == 0:
+		var err error
+		datasets, err = readConfig(*config)
+		if err != nil {
+			return err
+		}
+	case *config == "" && fs.NArg() == 1:
+		path := fs.Arg(0)
+		d := server.Dataset{
+			Name:        strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+			Path:        path,
+			Table:       *table,
+			MaxDistance: *distance,
+		}
+		if *columns != "" {
+			d.Columns = strings.Split(*columns, ",")
+		}
+		datasets = append(datasets, d)
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	for i, d := range datasets {
+		t, err := featureTable(d.Path, d.Table)
+		if err != nil {
+			return fmt.Errorf("error reading table of dataset %q: %w", d.Name, err)
+		}
+		datasets[i].Table = t
+		if len(d.Columns) > 0 {
+			continue
+		}
+		cols, err := allColumns(d.Path, t)
+		if err != nil {
+			return fmt.Errorf("error reading columns of dataset %q: %w", d.Name, err)
+		}
+		datasets[i].Columns = cols
+	}
+
+	s, err := server.New(datasets)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	hs := &http.Server{
+		Addr:              *addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		hs.Shutdown(shutdown)
+	}()
+	for _, d := range datasets {
+		fmt.Fprintf(w, "serving %s (%s) on http://%s/reverse?dataset=%s\n", d.Name, d.Path, *addr, d.Name)
+	}
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// readConfig reads the JSON array of datasets of a -config file, with the
+// relative paths of the datasets resolved against its directory
+func readConfig(path string) ([]server.Dataset, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var datasets []server.Dataset
+	if err := json.Unmarshal(b, &datasets); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	for i, d := range datasets {
+		if !filepath.IsAbs(d.Path) {
+			datasets[i].Path = filepath.Join(filepath.Dir(path), d.Path)
+		}
+	}
+	return datasets, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// validate checks the geometry headers and payloads of the feature tables
+// of a GeoPackage, their spatial reference systems and spatial indexes,
+// and prints the problems found
+func validate(args []string, w io.Writer) error {
+	fs := newFlagSet("validate", "validate [flags] <file>")
+	table := fs.String("table", "", "feature table to validate, all if empty")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	conn, err := openConn(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	cols, err := geometryColumns(conn, *table)
+	if err != nil {
+		return err
+	}
+	srsIds := make(map[int32]bool)
+	err = sqlitex.Execute(conn, `SELECT srs_id FROM gpkg_spatial_ref_sys`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			srsIds[stmt.ColumnInt32(0)] = true
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, c := range cols {
+		report := func(format string, args ...any) {
+			problems++
+			fmt.Fprintf(w, "%s: %s\n", c.table, fmt.Sprintf(format, args...))
+		}
+		if !srsIds[c.srsId] {
+			report("unknown srs %d", c.srsId)
+		}
+		n, err := validateTable(conn, c, srsIds, report)
+		if err != nil {
+			return fmt.Errorf("error validating %s: %w", c.table, err)
+		}
+		fmt.Fprintf(w, "%s: %d features checked\n", c.table, n)
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d problems found", problems)
+	}
+	fmt.Fprintln(w, "ok")
+	return nil
+}
+
+// validateTable validates the geometries of the column and its spatial
+// index, reporting problems with report, and returns the number of
+// features checked
+func validateTable(conn *sqlite.Conn, c geometryColumn, srsIds map[int32]bool, report func(format string, args ...any)) (int, error) {
+	fid, err := sqlutil.PrimaryKey(conn, c.table)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	indexed := make(map[int64]bool)
+	err = sqlitex.Execute(conn, `
+		SELECT `+sqlutil.QuoteIdent(fid)+`, `+sqlutil.QuoteIdent(c.column)+`
+		FROM `+sqlutil.QuoteIdent(c.table), &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			count++
+			id := stmt.ColumnInt64(0)
+			if stmt.ColumnType(1) == sqlite.TypeNull {
+				return nil
+			}
+			b := make([]byte, stmt.ColumnLen(1))
+			stmt.ColumnBytes(1, b)
+			empty, err := validateGeometry(b, c.srsId, srsIds)
+			if err != nil {
+				report("feature %d: %v", id, err)
+			}
+			if !empty {
+				indexed[id] = true
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return count, err
+	}
+
+	rtree := "rtree_" + c.table + "_" + c.column
+	exists := false
+	err = sqlitex.Execute(conn, `
+		SELECT 1
+		FROM sqlite_master
+		WHERE type = 'table' AND name = ?`, &sqlitex.ExecOptions{
+		Args: []any{rtree},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			exists = true
+			return nil
+		},
+	})
+	if err != nil {
+		return count, err
+	}
+	if !exists {
+		report("spatial index %s not found", rtree)
+		return count, nil
+	}
+	err = sqlitex.Execute(conn, `SELECT id FROM `+sqlutil.QuoteIdent(rtree), &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			id := stmt.ColumnInt64(0)
+			if !indexed[id] {
+				report("feature %d: indexed without a geometry", id)
+			}
+			delete(indexed, id)
+			return nil
+		},
+	})
+	if err != nil {
+		return count, err
+	}
+	missing := make([]int64, 0, len(indexed))
+	for id := range indexed {
+		missing = append(missing, id)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, id := range missing {
+		report("feature %d: not in the spatial index", id)
+	}
+	return count, nil
+}
+
+// validateGeometry validates the geometry blob b with the Strict checks of
+// the gpkg package, and returns whether it is empty
+func validateGeometry(b []byte, srsId int32, srsIds map[int32]bool) (bool, error) {
+	g, err := gpkg.ValidateGeometry(b, srsId, srsIds)
+	if err != nil {
+		h, _, herr := binary.ParseHeader(b)
+		return herr == nil && h.Empty(), err
+	}
+	return g.IsEmpty(), nil
+}
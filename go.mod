@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/golang/geo v0.0.0-20230421003525-6adc56603217
 	github.com/peterstace/simplefeatures v0.44.0
+	modernc.org/sqlite v1.27.0
 	zombiezen.com/go/sqlite v0.13.1
 )
 
@@ -24,7 +25,6 @@ require (
 	modernc.org/mathutil v1.6.0 // indirect
 	modernc.org/memory v1.7.2 // indirect
 	modernc.org/opt v0.1.3 // indirect
-	modernc.org/sqlite v1.27.0 // indirect
 	modernc.org/strutil v1.1.3 // indirect
 	modernc.org/token v1.1.0 // indirect
 )
@@ -0,0 +1,82 @@
+package gpkg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang/geo/s2"
+)
+
+// Result is the outcome of reverse geocoding a single point of a batch.
+type Result struct {
+	Feature Feature
+	// Err is ErrNotFound if no feature was found for the point, or any
+	// other error that occurred while querying it.
+	Err error
+}
+
+// ReverseGeocodeBatch reverse geocodes each point in ls like
+// ReverseGeocodeFeature and returns the results in the same order.
+//
+// Each worker reuses a single connection and its prepared statements for
+// all of its points. The points are spread over up to parallelism workers,
+// bounded by the number of pooled connections. A parallelism of zero or
+// less uses a single worker.
+//
+// Errors for individual points are returned in Result.Err. The returned
+// error is only set if the batch is interrupted, e.g. if the context is
+// canceled before all points are processed. The results are returned
+// either way, with Err of the points that were not processed set to the
+// returned error.
+func (g *GeoPackage) ReverseGeocodeBatch(ctx context.Context, ls []s2.LatLng, parallelism int) ([]Result, error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > poolSize {
+		parallelism = poolSize
+	}
+	if parallelism > len(ls) {
+		parallelism = len(ls)
+	}
+
+	results := make([]Result, len(ls))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn := g.pool.Get(ctx)
+			if conn == nil {
+				return
+			}
+			defer g.pool.Put(conn)
+
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= len(ls) {
+					return
+				}
+				f, err := g.feature(conn, ls[i])
+				results[i] = Result{Feature: f, Err: err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Points are claimed in order and every claimed point is finished
+	processed := int(next.Load())
+	if processed >= len(ls) {
+		return results, nil
+	}
+	err := ctx.Err()
+	if err == nil {
+		err = errors.New("batch interrupted")
+	}
+	for i := processed; i < len(ls); i++ {
+		results[i].Err = err
+	}
+	return results, err
+}
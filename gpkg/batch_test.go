@@ -0,0 +1,79 @@
+package gpkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestReverseGeocodeBatch(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	points := []struct {
+		l    s2.LatLng
+		want string
+	}{
+		{s2.LatLngFromDegrees(8, 8), "outer"},
+		{s2.LatLngFromDegrees(5, 25), "east"},
+		{s2.LatLngFromDegrees(5, 15), ""},
+		{s2.LatLngFromDegrees(1, 1), "outer"},
+	}
+	var ls []s2.LatLng
+	for i := 0; i < 100; i++ {
+		ls = append(ls, points[i%len(points)].l)
+	}
+
+	for _, parallelism := range []int{0, 1, 4, 100} {
+		results, err := g.ReverseGeocodeBatch(context.Background(), ls, parallelism)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != len(ls) {
+			t.Fatalf("got %d results, want %d", len(results), len(ls))
+		}
+		for i, r := range results {
+			want := points[i%len(points)].want
+			if want == "" {
+				if r.Err != ErrNotFound {
+					t.Errorf("parallelism %d, point %d: got %v, want ErrNotFound", parallelism, i, r.Err)
+				}
+				continue
+			}
+			if r.Err != nil {
+				t.Fatal(r.Err)
+			}
+			if got, _ := r.Feature.Value("name"); got != want {
+				t.Errorf("parallelism %d, point %d: got %q, want %q", parallelism, i, got, want)
+			}
+		}
+	}
+}
+
+func TestReverseGeocodeBatchCanceled(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ls := []s2.LatLng{s2.LatLngFromDegrees(8, 8), s2.LatLngFromDegrees(5, 25)}
+	results, err := g.ReverseGeocodeBatch(ctx, ls, 1)
+	if err != context.Canceled {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if len(results) != len(ls) {
+		t.Fatalf("got %d results, want %d", len(results), len(ls))
+	}
+	for i, r := range results {
+		if r.Err != context.Canceled {
+			t.Errorf("point %d: got error %v, want %v", i, r.Err, context.Canceled)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gpkg
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// LRUCache is a GeometryCache that keeps the most recently used
+// geometries in memory, up to a limit of estimated bytes. It is safe for
+// concurrent use.
+//
+// LRUCache also implements PreparedCache, so it can hold prepared
+// geometries if GeoPackage.Prepare is set.
+type LRUCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	order    *list.List
+	entries  map[FeatureId]*list.Element
+	stats    CacheStats
+}
+
+// CacheStats are the counters of an LRUCache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Entries is the number of cached geometries.
+	Entries int
+	// Bytes is the estimated size of the cached geometries.
+	Bytes int64
+}
+
+type lruEntry struct {
+	fid   FeatureId
+	g     geom.Geometry
+	p     *PreparedGeometry
+	bytes int64
+}
+
+// NewLRUCache returns an LRUCache holding geometries of up to maxBytes
+// total estimated size. The size of a geometry is estimated from the
+// number of its vertices.
+func NewLRUCache(maxBytes int64) *LRUCache {
+	return &LRUCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[FeatureId]*list.Element),
+	}
+}
+
+// Get returns the cached geometry of the feature fid, or ErrNotFound if
+// it is not cached.
+func (c *LRUCache) Get(fid FeatureId) (geom.Geometry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[fid]
+	if !ok {
+		c.stats.Misses++
+		return geom.Geometry{}, ErrNotFound
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).g, nil
+}
+
+// GetPrepared returns the cached prepared geometry of the feature fid, or
+// ErrNotFound if it is not cached or only its geometry is cached.
+func (c *LRUCache) GetPrepared(fid FeatureId) (*PreparedGeometry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[fid]
+	if !ok || el.Value.(*lruEntry).p == nil {
+		c.stats.Misses++
+		return nil, ErrNotFound
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).p, nil
+}
+
+// Set caches the geometry of the feature fid, evicting the least recently
+// used geometries if the cache is full. Geometries larger than the whole
+// cache are not cached.
+func (c *LRUCache) Set(fid FeatureId, g geom.Geometry) error {
+	c.set(&lruEntry{
+		fid:   fid,
+		g:     g,
+		bytes: geometrySize(g),
+	})
+	return nil
+}
+
+// SetPrepared caches the prepared geometry of the feature fid, like Set.
+// The estimated size includes the size of the index.
+func (c *LRUCache) SetPrepared(fid FeatureId, p *PreparedGeometry) error {
+	c.set(&lruEntry{
+		fid:   fid,
+		g:     p.Geometry(),
+		p:     p,
+		bytes: geometrySize(p.Geometry()) + p.size(),
+	})
+	return nil
+}
+
+func (c *LRUCache) set(e *lruEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.fid]; ok {
+		c.remove(el)
+	}
+	if e.bytes > c.maxBytes {
+		return
+	}
+	for c.bytes+e.bytes > c.maxBytes {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	c.entries[e.fid] = c.order.PushFront(e)
+	c.bytes += e.bytes
+}
+
+// Stats returns the current counters of the cache.
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = len(c.entries)
+	s.Bytes = c.bytes
+	return s
+}
+
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.fid)
+	c.bytes -= e.bytes
+}
+
+// geometrySize estimates the memory used by the decoded geometry g
+func geometrySize(g geom.Geometry) int64 {
+	// approximate size of the structs and slice headers of a part
+	const partOverhead = 64
+	coordSize := int64(8 * g.CoordinatesType().Dimension())
+	var size int64
+	for _, part := range g.Dump() {
+		size += partOverhead
+		switch part.Type() {
+		case geom.TypePoint:
+			size += coordSize
+		case geom.TypeLineString:
+			size += coordSize * int64(part.MustAsLineString().Coordinates().Length())
+		case geom.TypePolygon:
+			poly := part.MustAsPolygon()
+			size += coordSize * int64(poly.ExteriorRing().Coordinates().Length())
+			for i := 0; i < poly.NumInteriorRings(); i++ {
+				size += partOverhead
+				size += coordSize * int64(poly.InteriorRingN(i).Coordinates().Length())
+			}
+		}
+	}
+	return size
+}
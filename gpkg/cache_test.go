@@ -0,0 +1,109 @@
+package gpkg
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func TestLRUCache(t *testing.T) {
+	square, err := geom.UnmarshalWKT("POLYGON((0 0,1 0,1 1,0 1,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := geometrySize(square)
+	c := NewLRUCache(2 * size)
+
+	if _, err := c.Get(1); err != ErrNotFound {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	c.Set(1, square)
+	c.Set(2, square)
+	if _, err := c.Get(1); err != nil {
+		t.Fatal(err)
+	}
+	// 2 is the least recently used and gets evicted
+	c.Set(3, square)
+	if _, err := c.Get(2); err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound for evicted geometry", err)
+	}
+	if _, err := c.Get(3); err != nil {
+		t.Error(err)
+	}
+
+	want := CacheStats{Hits: 2, Misses: 2, Evictions: 1, Entries: 2, Bytes: 2 * size}
+	if got := c.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestLRUCacheTooLarge(t *testing.T) {
+	square, err := geom.UnmarshalWKT("POLYGON((0 0,1 0,1 1,0 1,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewLRUCache(geometrySize(square) - 1)
+	c.Set(1, square)
+	if got := c.Stats(); got.Entries != 0 || got.Bytes != 0 {
+		t.Errorf("got %+v, want empty cache", got)
+	}
+}
+
+func TestLRUCacheReverseGeocode(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cache := NewLRUCache(1 << 20)
+	g.Cache = cache
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got[0] != "east" {
+					t.Errorf("got %q, want %q", got, "east")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	if stats.Entries != 1 || stats.Hits == 0 {
+		t.Errorf("got %+v, want 1 entry with hits", stats)
+	}
+}
+
+func TestGeometrySize(t *testing.T) {
+	tests := []struct {
+		wkt  string
+		want int64
+	}{
+		{"POINT(1 2)", 64 + 16},
+		{"POINT Z(1 2 3)", 64 + 24},
+		{"LINESTRING(0 0,1 1,2 2)", 64 + 3*16},
+		{"POLYGON((0 0,4 0,4 4,0 4,0 0),(1 1,2 1,2 2,1 1))", 2*64 + 9*16},
+		{"MULTIPOINT((0 0),(1 1))", 2 * (64 + 16)},
+	}
+	for _, tt := range tests {
+		g, err := geom.UnmarshalWKT(tt.wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := geometrySize(g); got != tt.want {
+			t.Errorf("geometrySize(%s) = %d, want %d", tt.wkt, got, tt.want)
+		}
+	}
+}
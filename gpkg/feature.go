@@ -0,0 +1,59 @@
+package gpkg
+
+import (
+	"github.com/peterstace/simplefeatures/geom"
+	"zombiezen.com/go/sqlite"
+)
+
+// Feature is a feature returned from a reverse geocoding query.
+type Feature struct {
+	Id FeatureId
+	// Columns are the names of the columns specified in Open. The slice
+	// is shared between features and must not be modified.
+	Columns []string
+	// Values of the columns, in the same order as Columns. Each value is
+	// one of int64, float64, string, []byte or nil, depending on the
+	// type of the value stored in the GeoPackage.
+	Values []any
+	// Geometry is the decoded geometry of the feature in the spatial
+	// reference system of the table, see GeoPackage.Unproject.
+	Geometry geom.Geometry
+	// Distance is the great-circle distance in meters from the queried
+	// point to the feature, zero if the feature contains the point.
+	Distance float64
+}
+
+// Value returns the value of the column col, or false if the column
+// was not selected.
+func (f Feature) Value(col string) (any, bool) {
+	for i, c := range f.Columns {
+		if c == col && i < len(f.Values) {
+			return f.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// readValues returns n typed columns of the current row of stmt,
+// starting at column offset
+func readValues(stmt *sqlite.Stmt, offset, n int) []any {
+	values := make([]any, n)
+	for i := 0; i < n; i++ {
+		col := offset + i
+		switch stmt.ColumnType(col) {
+		case sqlite.TypeInteger:
+			values[i] = stmt.ColumnInt64(col)
+		case sqlite.TypeFloat:
+			values[i] = stmt.ColumnFloat(col)
+		case sqlite.TypeText:
+			values[i] = stmt.ColumnText(col)
+		case sqlite.TypeBlob:
+			b := make([]byte, stmt.ColumnLen(col))
+			stmt.ColumnBytes(col, b)
+			values[i] = b
+		case sqlite.TypeNull:
+			values[i] = nil
+		}
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package gpkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestReverseGeocodeFeature(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name", "rank", "area", "code"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		name string
+		l    s2.LatLng
+		want []any
+	}{
+		{
+			name: "null blob",
+			l:    s2.LatLngFromDegrees(8, 8),
+			want: []any{"outer", int64(1), 100.0, nil},
+		},
+		{
+			name: "blob",
+			l:    s2.LatLngFromDegrees(3, 3),
+			want: []any{"inner", int64(2), 4.0, []byte{0x01}},
+		},
+	}
+
+	g.Order = Order{Column: "rank", Direction: Desc}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.ReverseGeocodeFeature(context.Background(), tt.l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.Values, tt.want) {
+				t.Errorf("got %#v, want %#v", got.Values, tt.want)
+			}
+			if got.Geometry.IsEmpty() {
+				t.Errorf("got empty geometry")
+			}
+		})
+	}
+}
+
+func TestReverseGeocodeText(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name", "rank", "area"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(8, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"outer", "1", "100.0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFeature_Value(t *testing.T) {
+	f := Feature{
+		Columns: []string{"name", "rank"},
+		Values:  []any{"outer", int64(1)},
+	}
+	if v, ok := f.Value("rank"); !ok || v != int64(1) {
+		t.Errorf("Value(rank) = %v, %v, want 1, true", v, ok)
+	}
+	if v, ok := f.Value("missing"); ok {
+		t.Errorf("Value(missing) = %v, %v, want nil, false", v, ok)
+	}
+}
@@ -0,0 +1,142 @@
+package gpkg
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+)
+
+// Operator compares a column to the value of a Filter
+type Operator string
+
+const (
+	Eq        Operator = "="
+	Ne        Operator = "!="
+	Lt        Operator = "<"
+	Le        Operator = "<="
+	Gt        Operator = ">"
+	Ge        Operator = ">="
+	Like      Operator = "LIKE"
+	IsNull    Operator = "IS NULL"
+	IsNotNull Operator = "IS NOT NULL"
+)
+
+// Filter restricts the features matched by a query to those where
+// Column compares to Value with Op, e.g.
+//
+//	Filter{Column: "admin_level", Op: Eq, Value: 4}
+//
+// Value can be a bool, an integer, a float, a string, a []byte or a
+// time.Time, which is compared as GeoPackage DATETIME text. It is ignored
+// for IsNull and IsNotNull. A nil Value matches NULL with Eq and anything
+// else with Ne, like IsNull and IsNotNull, and is invalid with the other
+// operators.
+type Filter struct {
+	Column string
+	Op     Operator
+	Value  any
+}
+
+// filterSQL returns the WHERE conditions of Filters, prefixed with AND,
+// with their values as named parameters to be bound with bindFilters
+func (g *GeoPackage) filterSQL() (string, error) {
+	sql := ""
+	for i, f := range g.Filters {
+		col, err := g.column(f.Column)
+		if err != nil {
+			return "", fmt.Errorf("invalid filter: %w", err)
+		}
+		switch f.operator() {
+		case Eq, Ne, Lt, Le, Gt, Ge, Like:
+			if f.Value == nil {
+				return "", fmt.Errorf("invalid filter: nil value with operator %q", f.Op)
+			}
+			if _, ok := filterValue(f.Value); !ok {
+				return "", fmt.Errorf("invalid filter: unsupported value type %T", f.Value)
+			}
+			sql += ` AND ` + sqlutil.QuoteIdent(col) + ` ` + string(f.Op) + ` ` + filterParam(i)
+		case IsNull, IsNotNull:
+			sql += ` AND ` + sqlutil.QuoteIdent(col) + ` ` + string(f.operator())
+		default:
+			return "", fmt.Errorf("invalid filter: unsupported operator %q", f.Op)
+		}
+	}
+	return sql, nil
+}
+
+// bindFilters binds the values of Filters to the parameters of a
+// statement prepared with the conditions of filterSQL
+func (g *GeoPackage) bindFilters(stmt *sqlite.Stmt) {
+	for i, f := range g.Filters {
+		if op := f.operator(); op == IsNull || op == IsNotNull {
+			continue
+		}
+		name := filterParam(i)
+		// the value was validated by filterSQL
+		v, _ := filterValue(f.Value)
+		switch v := v.(type) {
+		case int64:
+			stmt.SetInt64(name, v)
+		case float64:
+			stmt.SetFloat(name, v)
+		case string:
+			stmt.SetText(name, v)
+		case []byte:
+			stmt.SetBytes(name, v)
+		}
+	}
+}
+
+// operator returns Op, or IsNull and IsNotNull for Eq and Ne with a nil
+// Value, as comparing with NULL never matches in SQL
+func (f Filter) operator() Operator {
+	if f.Value == nil {
+		switch f.Op {
+		case Eq:
+			return IsNull
+		case Ne:
+			return IsNotNull
+		}
+	}
+	return f.Op
+}
+
+func filterParam(i int) string {
+	return ":filter" + strconv.Itoa(i)
+}
+
+// filterValue returns v as the SQLite type it is bound as
+func filterValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case int64, float64, string, []byte:
+		return v, true
+	case bool:
+		if v {
+			return int64(1), true
+		}
+		return int64(0), true
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case float32:
+		return float64(v), true
+	case time.Time:
+		return v.UTC().Format("2006-01-02T15:04:05.000Z"), true
+	default:
+		return nil, false
+	}
+}
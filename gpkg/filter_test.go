@@ -0,0 +1,130 @@
+package gpkg
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestFilters(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Order = Order{Column: "rank", Direction: Asc}
+
+	tests := []struct {
+		name    string
+		filters []Filter
+		want    []string
+	}{
+		{"none", nil, []string{"outer", "inner"}},
+		{"int", []Filter{{Column: "rank", Op: Gt, Value: 1}}, []string{"inner"}},
+		{"float", []Filter{{Column: "area", Op: Ge, Value: 50.0}}, []string{"outer"}},
+		{"text", []Filter{{Column: "NAME", Op: Eq, Value: "outer"}}, []string{"outer"}},
+		{"like", []Filter{{Column: "name", Op: Like, Value: "in%"}}, []string{"inner"}},
+		{"null", []Filter{{Column: "code", Op: IsNull}}, []string{"outer"}},
+		{"not null", []Filter{{Column: "code", Op: IsNotNull}}, []string{"inner"}},
+		{"eq nil", []Filter{{Column: "code", Op: Eq, Value: nil}}, []string{"outer"}},
+		{"ne nil", []Filter{{Column: "code", Op: Ne, Value: nil}}, []string{"inner"}},
+		{"and", []Filter{
+			{Column: "rank", Op: Le, Value: int32(2)},
+			{Column: "name", Op: Ne, Value: "inner"},
+		}, []string{"outer"}},
+		{"no match", []Filter{{Column: "rank", Op: Lt, Value: 0}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.Filters = tt.filters
+			fs, err := g.ReverseGeocodeAll(context.Background(), s2.LatLngFromDegrees(3, 3))
+			if tt.want == nil {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range fs {
+				got = append(got, f.Values[0].(string))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFiltersNearest(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.MaxDistance = 1_000_000
+	g.Filters = []Filter{{Column: "name", Op: Eq, Value: "east"}}
+
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != "east" {
+		t.Errorf("got %q, want %q", got, "east")
+	}
+}
+
+func TestFilters_Invalid(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantErr error
+	}{
+		{"unknown column", Filter{Column: "missing", Op: Eq, Value: 1}, ErrUnknownColumn},
+		{"operator", Filter{Column: "rank", Op: "= 1 OR 1 =", Value: 1}, nil},
+		{"value", Filter{Column: "rank", Op: Eq, Value: struct{}{}}, nil},
+		{"nil value", Filter{Column: "rank", Op: Lt, Value: nil}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.Filters = []Filter{tt.filter}
+			_, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(3, 3))
+			if err == nil || err == ErrNotFound {
+				t.Fatalf("got %v, want error", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterValue(t *testing.T) {
+	tests := []struct {
+		v    any
+		want any
+	}{
+		{true, int64(1)},
+		{uint16(7), int64(7)},
+		{float32(0.5), float64(0.5)},
+		{time.Date(2020, 1, 2, 4, 4, 5, 0, time.FixedZone("", 3600)), "2020-01-02T03:04:05.000Z"},
+	}
+	for _, tt := range tests {
+		got, ok := filterValue(tt.v)
+		if !ok || got != tt.want {
+			t.Errorf("filterValue(%v) = %v, %v, want %v", tt.v, got, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package gpkg
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"net/url"
+	"time"
+
+	"modernc.org/sqlite/vfs"
+)
+
+// OpenFS opens a read-only GeoPackage file from the file system fsys, see
+// Open for the table and cols parameters.
+//
+// This can be used to open GeoPackages embedded in the binary with
+// embed.FS without extracting them first. The file must implement
+// io.Seeker, which is the case for embed.FS and os.DirFS files.
+func OpenFS(fsys fs.FS, name, table string, cols []string) (*GeoPackage, error) {
+	vname, vfsys, err := vfs.New(fsys)
+	if err != nil {
+		return nil, err
+	}
+	uri := "file:" + url.PathEscape(name) + "?vfs=" + vname + "&immutable=1"
+	return open(uri, vfsys, table, cols)
+}
+
+// OpenReaderAt opens a read-only GeoPackage of the given size from r,
+// see Open for the table and cols parameters.
+func OpenReaderAt(r io.ReaderAt, size int64, table string, cols []string) (*GeoPackage, error) {
+	return OpenFS(readerAtFS{r: r, size: size}, readerAtName, table, cols)
+}
+
+// OpenBytes opens a read-only GeoPackage from its contents b, see Open
+// for the table and cols parameters. b must not be modified while the
+// GeoPackage is open.
+func OpenBytes(b []byte, table string, cols []string) (*GeoPackage, error) {
+	return OpenReaderAt(bytes.NewReader(b), int64(len(b)), table, cols)
+}
+
+// readerAtName is the name of the only file in a readerAtFS
+const readerAtName = "db.gpkg"
+
+// readerAtFS is a file system containing a single file read from r
+type readerAtFS struct {
+	r    io.ReaderAt
+	size int64
+}
+
+func (f readerAtFS) Open(name string) (fs.File, error) {
+	if name != readerAtName {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &readerAtFile{
+		SectionReader: io.NewSectionReader(f.r, 0, f.size),
+	}, nil
+}
+
+// readerAtFile is an open readerAtFS file, each with its own offset
+type readerAtFile struct {
+	*io.SectionReader
+}
+
+func (f *readerAtFile) Stat() (fs.FileInfo, error) {
+	return readerAtInfo{size: f.Size()}, nil
+}
+
+func (f *readerAtFile) Close() error {
+	return nil
+}
+
+// readerAtInfo describes a readerAtFile
+type readerAtInfo struct {
+	size int64
+}
+
+func (i readerAtInfo) Name() string       { return readerAtName }
+func (i readerAtInfo) Size() int64        { return i.size }
+func (i readerAtInfo) Mode() fs.FileMode  { return 0444 }
+func (i readerAtInfo) ModTime() time.Time { return time.Time{} }
+func (i readerAtInfo) IsDir() bool        { return false }
+func (i readerAtInfo) Sys() any           { return nil }
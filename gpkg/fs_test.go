@@ -0,0 +1,62 @@
+package gpkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestOpenFS(t *testing.T) {
+	path := createTestGeoPackage(t, testFeatures)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		open func() (*GeoPackage, error)
+	}{
+		{
+			name: "fs",
+			open: func() (*GeoPackage, error) {
+				return OpenFS(os.DirFS(filepath.Dir(path)), filepath.Base(path), "", []string{"name"})
+			},
+		},
+		{
+			name: "bytes",
+			open: func() (*GeoPackage, error) {
+				return OpenBytes(b, "", []string{"name"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := tt.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+
+			got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "east" {
+				t.Errorf("got %q, want %q", got, "east")
+			}
+		})
+	}
+}
+
+func TestOpenFSNotFound(t *testing.T) {
+	g, err := OpenFS(os.DirFS(t.TempDir()), "missing.gpkg", "", []string{"name"})
+	if err == nil {
+		g.Close()
+		t.Fatal("got nil error, want error")
+	}
+}
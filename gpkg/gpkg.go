@@ -1,20 +1,23 @@
 package gpkg
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"strings"
 
 	"github.com/golang/geo/s2"
 	"github.com/peterstace/simplefeatures/geom"
 	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"modernc.org/sqlite/vfs"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
 var ErrNotFound = errors.New("not found")
+var ErrUnknownTable = errors.New("unknown table")
+var ErrUnknownColumn = errors.New("unknown column")
 var poolSize = 10
 
 var skipValidationOpts = []geom.ConstructorOption{
@@ -41,12 +44,40 @@ type GeometryCache interface {
 
 type GeoPackage struct {
 	pool      *sqlitex.Pool
+	vfs       *vfs.FS
 	table     string
+	fidCol    string
+	geomCol   string
+	rtree     string
+	srsId     int32
+	srsIds    map[int32]bool
+	proj      projection
+	columns   map[string]string
 	cols      []string
 	colSelect string
 	Order     Order
-	Validate  bool
-	Cache     GeometryCache
+	// Filters restrict the features matched by queries to those matching
+	// all of the filters, see Filter.
+	Filters  []Filter
+	Validate bool
+	Cache    GeometryCache
+	// Prepare enables indexing the polygon edges of each decoded geometry
+	// for faster point-in-polygon tests, see PreparedGeometry. The index
+	// is only built if Cache implements PreparedCache, e.g. LRUCache, as
+	// it is only worth it for features that are queried repeatedly.
+	Prepare bool
+	// MaxDistance is the maximum distance in meters within which the
+	// nearest feature is returned if no feature contains the queried
+	// point. Zero disables the nearest feature fallback.
+	MaxDistance float64
+	// Strict enables validation of the geometry blobs of untrusted
+	// GeoPackages. Blobs with an unknown version, an invalid envelope
+	// contents indicator code, an SRS id not defined in
+	// "gpkg_spatial_ref_sys" or different from the one of the geometry
+	// column, or an empty flag or envelope that does not match the
+	// geometry are rejected with a FeatureError. The envelope of TWKB
+	// geometries may be off by the rounding of their coordinates.
+	Strict bool
 }
 
 // Open opens a GeoPackage file at the specified path
@@ -56,25 +87,49 @@ type GeoPackage struct {
 // If table is an empty string, Open will attempt to auto-configure
 // using the first table listed in "gpkg_contents".
 //
+// The geometry column is read from "gpkg_geometry_columns" and the
+// primary key from the table schema, so tables using e.g. "geometry"
+// or "shape" columns are supported as long as they have a spatial index.
+//
 // cols defines the columns of the table to return from ReverseGeocode.
 //
-// You can set the Cache field to a GeometryCache implementation to
-// cache geometries in memory. This can be useful if you are querying
+// You can set the Cache field to a GeometryCache implementation, e.g.
+// NewLRUCache, to cache geometries in memory. This can be useful if you are querying
 // similar locations multiple times.
-
-// Warning: the table and columns are not sanitized, so they are prone
-// to SQL injection attacks if provided by user input.
+//
+// You can set the MaxDistance field to fall back to the nearest feature
+// for points that are not contained in any feature, e.g. GPS fixes just
+// off the coast.
+//
+// The table and columns are validated against the schema of the
+// GeoPackage, Open returns ErrUnknownTable or ErrUnknownColumn if they
+// do not exist. Identifiers are quoted when building queries, so they are
+// safe to use with user input.
+//
+// Queried points are transformed into the spatial reference system of the
+// geometry column, which can be EPSG:4326, Web Mercator (EPSG:3857) or a
+// transverse Mercator projection like UTM (EPSG:326xx, EPSG:327xx), the
+// latter also if it is only described by its WKT definition. Open returns
+// ErrUnsupportedSrs for other systems.
 func Open(path, table string, cols []string) (*GeoPackage, error) {
+	return open(path, nil, table, cols)
+}
+
+// open opens the GeoPackage at the SQLite URI, closing fsys with the
+// GeoPackage if it is not nil
+func open(uri string, fsys *vfs.FS, table string, cols []string) (*GeoPackage, error) {
 	g := &GeoPackage{}
 	var err error
+	g.vfs = fsys
 	g.table = table
 	g.cols = cols
 	g.pool, err = sqlitex.Open(
-		path,
+		uri,
 		sqlite.OpenReadOnly|sqlite.OpenURI,
 		poolSize,
 	)
 	if err != nil {
+		g.Close()
 		return nil, err
 	}
 	if g.table == "" {
@@ -83,13 +138,28 @@ func Open(path, table string, cols []string) (*GeoPackage, error) {
 			return nil, err
 		}
 	}
+	if err := g.autoconfColumns(); err != nil {
+		g.Close()
+		return nil, err
+	}
+	if err := g.autoconfSrs(); err != nil {
+		g.Close()
+		return nil, err
+	}
 	if len(g.cols) == 0 {
 		g.Close()
 		return nil, errors.New("no columns specified")
 	}
-	g.colSelect = g.cols[0]
-	for i := 1; i < len(g.cols); i++ {
-		g.colSelect += ", " + g.cols[i]
+	for i, col := range g.cols {
+		name, err := g.column(col)
+		if err != nil {
+			g.Close()
+			return nil, err
+		}
+		if i > 0 {
+			g.colSelect += ", "
+		}
+		g.colSelect += sqlutil.QuoteIdent(name)
 	}
 	return g, nil
 }
@@ -98,152 +168,538 @@ func (g *GeoPackage) autoconfTable() error {
 	conn := g.pool.Get(context.Background())
 	defer g.pool.Put(conn)
 
-	sql := `
+	table, err := defaultTable(conn)
+	if err != nil {
+		return err
+	}
+	g.table = table
+	return nil
+}
+
+// DefaultTable returns the table of the GeoPackage at path that Open
+// uses if no table is specified, the first table in "gpkg_contents".
+func DefaultTable(path string) (string, error) {
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly|sqlite.OpenURI)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return defaultTable(conn)
+}
+
+func defaultTable(conn *sqlite.Conn) (string, error) {
+	stmt := conn.Prep(`
 		SELECT table_name
 		FROM gpkg_contents
-		LIMIT 1`
-
-	stmt := conn.Prep(sql)
+		LIMIT 1`)
 	defer stmt.Reset()
 
 	if exists, err := stmt.Step(); err != nil {
-		return fmt.Errorf("error auto-configuring table: %w", err)
+		return "", fmt.Errorf("error auto-configuring table: %w", err)
 	} else if !exists {
-		return errors.New("error auto-configuring table: no table found")
+		return "", errors.New("error auto-configuring table: no table found")
+	}
+
+	table := stmt.ColumnText(0)
+	if table == "" {
+		return "", errors.New("error auto-configuring table: table name is empty")
 	}
+	return table, nil
+}
 
+// autoconfColumns reads the columns, geometry column, primary key and
+// spatial index of the table
+func (g *GeoPackage) autoconfColumns() error {
+	conn := g.pool.Get(context.Background())
+	defer g.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT name
+		FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name = :table COLLATE NOCASE`)
+	stmt.SetText(":table", g.table)
+	if exists, err := stmt.Step(); err != nil {
+		stmt.Reset()
+		return fmt.Errorf("error auto-configuring table: %w", err)
+	} else if !exists {
+		stmt.Reset()
+		return fmt.Errorf("%w: %s", ErrUnknownTable, g.table)
+	}
 	g.table = stmt.ColumnText(0)
-	if g.table == "" {
-		return errors.New("error auto-configuring table: table name is empty")
+	stmt.Reset()
+
+	stmt = conn.Prep(`
+		SELECT name
+		FROM pragma_table_info(:table)`)
+	stmt.SetText(":table", g.table)
+	g.columns = make(map[string]string)
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			stmt.Reset()
+			return fmt.Errorf("error auto-configuring columns: %w", err)
+		} else if !exists {
+			break
+		}
+		name := stmt.ColumnText(0)
+		g.columns[strings.ToLower(name)] = name
+	}
+	stmt.Reset()
+
+	// Tables without an integer primary key are indexed by rowid
+	var err error
+	g.fidCol, err = sqlutil.PrimaryKey(conn, g.table)
+	if err != nil {
+		return fmt.Errorf("error auto-configuring primary key: %w", err)
+	}
+
+	stmt = conn.Prep(`
+		SELECT column_name, srs_id
+		FROM gpkg_geometry_columns
+		WHERE table_name = :table`)
+	stmt.SetText(":table", g.table)
+	if exists, err := stmt.Step(); err != nil {
+		stmt.Reset()
+		return fmt.Errorf("error auto-configuring geometry column: %w", err)
+	} else if !exists {
+		stmt.Reset()
+		return fmt.Errorf("error auto-configuring geometry column: no geometry column found for table %s", g.table)
+	}
+	geomCol := stmt.ColumnText(0)
+	g.srsId = stmt.ColumnInt32(1)
+	stmt.Reset()
+	g.geomCol, err = g.column(geomCol)
+	if err != nil {
+		return fmt.Errorf("error auto-configuring geometry column: %w", err)
+	}
+
+	g.rtree = "rtree_" + g.table + "_" + g.geomCol
+	stmt = conn.Prep(`
+		SELECT 1
+		FROM sqlite_master
+		WHERE type = 'table' AND name = :name`)
+	defer stmt.Reset()
+	stmt.SetText(":name", g.rtree)
+	if exists, err := stmt.Step(); err != nil {
+		return fmt.Errorf("error auto-configuring spatial index: %w", err)
+	} else if !exists {
+		return fmt.Errorf("error auto-configuring spatial index: %s not found", g.rtree)
+	}
+	return nil
+}
+
+// autoconfSrs reads the ids of the spatial reference systems defined in
+// the GeoPackage and the projection of the spatial reference system of
+// the geometry column
+func (g *GeoPackage) autoconfSrs() error {
+	conn := g.pool.Get(context.Background())
+	defer g.pool.Put(conn)
+
+	stmt := conn.Prep(`
+		SELECT srs_id, organization, organization_coordsys_id, definition
+		FROM gpkg_spatial_ref_sys`)
+	defer stmt.Reset()
+
+	g.srsIds = make(map[int32]bool)
+	found := false
+	for {
+		if exists, err := stmt.Step(); err != nil {
+			return fmt.Errorf("error auto-configuring spatial reference systems: %w", err)
+		} else if !exists {
+			break
+		}
+		id := stmt.ColumnInt32(0)
+		g.srsIds[id] = true
+		if id != g.srsId {
+			continue
+		}
+		proj, err := newProjection(id, stmt.ColumnText(1), stmt.ColumnInt64(2), stmt.ColumnText(3))
+		if err != nil {
+			return fmt.Errorf("error auto-configuring spatial reference system %d: %w", id, err)
+		}
+		g.proj = proj
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("error auto-configuring spatial reference system: %w: %d", ErrUnknownSrs, g.srsId)
 	}
 	return nil
 }
 
+// column returns the name of the column col as defined in the table
+// schema, or ErrUnknownColumn if there is no such column.
+func (g *GeoPackage) column(col string) (string, error) {
+	name, ok := g.columns[strings.ToLower(col)]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownColumn, col)
+	}
+	return name, nil
+}
+
 func (g *GeoPackage) Close() error {
-	if g == nil || g.pool == nil {
+	if g == nil {
 		return nil
 	}
-	err := g.pool.Close()
-	if err != nil {
-		return fmt.Errorf("error closing geopackage: %w", err)
+	if g.pool != nil {
+		err := g.pool.Close()
+		if err != nil {
+			return fmt.Errorf("error closing geopackage: %w", err)
+		}
+		g.pool = nil
+	}
+	if g.vfs != nil {
+		err := g.vfs.Close()
+		if err != nil {
+			return fmt.Errorf("error closing geopackage: %w", err)
+		}
+		g.vfs = nil
 	}
-	g.pool = nil
 	return nil
 }
 
-func (g *GeoPackage) ReverseGeocode(ctx context.Context, l s2.LatLng) ([]string, error) {
+// conn returns a connection from the pool, or the error of ctx if it is
+// done before one is available
+func (g *GeoPackage) conn(ctx context.Context) (*sqlite.Conn, error) {
 	conn := g.pool.Get(ctx)
+	if conn == nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("no connection available")
+	}
+	return conn, nil
+}
+
+// ReverseGeocode returns the columns of the first feature containing l,
+// in the order specified by Order, or ErrNotFound if there is none.
+// The columns are returned as text, see ReverseGeocodeFeature for
+// typed values.
+//
+// If MaxDistance is set and no feature contains l, the columns of the
+// nearest feature within MaxDistance are returned instead.
+func (g *GeoPackage) ReverseGeocode(ctx context.Context, l s2.LatLng) ([]string, error) {
+	conn, err := g.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer g.pool.Put(conn)
+
+	var cols []string
+	_, err = g.first(conn, l, func(stmt *sqlite.Stmt, offset int) {
+		cols = g.readText(stmt, offset)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cols, nil
+}
+
+// ReverseGeocodeFeature returns the first feature containing l, in the
+// order specified by Order, or ErrNotFound if there is none.
+//
+// If MaxDistance is set and no feature contains l, the nearest feature
+// within MaxDistance is returned instead, with Distance set accordingly.
+func (g *GeoPackage) ReverseGeocodeFeature(ctx context.Context, l s2.LatLng) (Feature, error) {
+	conn, err := g.conn(ctx)
+	if err != nil {
+		return Feature{}, err
+	}
+	defer g.pool.Put(conn)
+
+	return g.feature(conn, l)
+}
+
+// feature returns the first feature containing l, or the nearest one
+// within MaxDistance, with its typed values
+func (g *GeoPackage) feature(conn *sqlite.Conn, l s2.LatLng) (Feature, error) {
+	var values []any
+	f, err := g.first(conn, l, func(stmt *sqlite.Stmt, offset int) {
+		values = readValues(stmt, offset, len(g.cols))
+	})
+	if err != nil {
+		return Feature{}, err
+	}
+	f.Values = values
+	return f, nil
+}
+
+// ReverseGeocodeAll returns all features containing l, in the order
+// specified by Order, or ErrNotFound if there are none.
+//
+// This is useful for datasets with overlapping geometries, e.g. disputed
+// areas or nested administrative levels in the same table.
+func (g *GeoPackage) ReverseGeocodeAll(ctx context.Context, l s2.LatLng) ([]Feature, error) {
+	conn, err := g.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer g.pool.Put(conn)
 
+	var features []Feature
+	err = g.contains(conn, l, func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) bool {
+		features = append(features, Feature{
+			Id:       fid,
+			Columns:  g.cols,
+			Values:   readValues(stmt, 2, len(g.cols)),
+			Geometry: gm,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, ErrNotFound
+	}
+	return features, nil
+}
+
+// first finds the first feature containing l, or the nearest one within
+// MaxDistance if it is set, and calls read with the statement positioned
+// on its row and the offset of the selected columns. The returned feature
+// has no Values, as they are left to read.
+func (g *GeoPackage) first(conn *sqlite.Conn, l s2.LatLng, read func(stmt *sqlite.Stmt, offset int)) (Feature, error) {
+	var f Feature
+	found := false
+	err := g.contains(conn, l, func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) bool {
+		read(stmt, 2)
+		f = Feature{
+			Id:       fid,
+			Columns:  g.cols,
+			Geometry: gm,
+		}
+		found = true
+		return false
+	})
+	if err != nil {
+		return Feature{}, err
+	}
+	if found {
+		return f, nil
+	}
+	if g.MaxDistance <= 0 {
+		return Feature{}, ErrNotFound
+	}
+	f, err = g.nearest(conn, l, g.MaxDistance)
+	if err != nil {
+		return Feature{}, err
+	}
+	err = g.row(conn, f.Id, read)
+	if err != nil {
+		return Feature{}, err
+	}
+	return f, nil
+}
+
+// contains calls fn for each feature containing l, in the order specified
+// by Order, until fn returns false. The statement passed to fn is
+// positioned on the row of the feature, with the selected columns
+// starting at column 2.
+func (g *GeoPackage) contains(conn *sqlite.Conn, l s2.LatLng, fn func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) bool) error {
 	sql := `
-		SELECT fid, geom, ` + g.colSelect + `
-		FROM ` + g.table + `
-		WHERE fid IN (
+		SELECT ` + sqlutil.QuoteIdent(g.fidCol) + `, ` + sqlutil.QuoteIdent(g.geomCol) + `, ` + g.colSelect + `
+		FROM ` + sqlutil.QuoteIdent(g.table) + `
+		WHERE ` + sqlutil.QuoteIdent(g.fidCol) + ` IN (
 			SELECT id
-			FROM rtree_` + g.table + `_geom
+			FROM ` + sqlutil.QuoteIdent(g.rtree) + `
 			WHERE
 				:x >= minx AND :x <= maxx AND
 				:y >= miny AND :y <= maxy
 		)`
 
-	if g.Order.Column != "" {
-		if g.Order.Direction != Asc && g.Order.Direction != Desc {
-			return nil, errors.New("invalid order direction")
-		}
-		sql += ` ORDER BY ` + g.Order.Column + ` ` + string(g.Order.Direction)
+	filters, err := g.filterSQL()
+	if err != nil {
+		return err
+	}
+	sql += filters
+
+	order, err := g.orderSQL()
+	if err != nil {
+		return err
 	}
+	sql += order
 
 	stmt := conn.Prep(sql)
 	defer stmt.Reset()
 
-	stmt.BindFloat(1, l.Lng.Degrees())
-	stmt.BindFloat(2, l.Lat.Degrees())
+	xy := g.point(l)
+	stmt.BindFloat(1, xy.X)
+	stmt.BindFloat(2, xy.Y)
+	g.bindFilters(stmt)
 
-	var opts []geom.ConstructorOption
-	if !g.Validate {
-		opts = skipValidationOpts
-	}
+	// validations are skipped, so there is no error to handle
+	pt, _ := xy.AsPoint(skipValidationOpts...)
+	p := pt.AsGeometry()
+	r := blobReader{stmt: stmt, col: 1}
 
 	for {
 		if exists, err := stmt.Step(); err != nil {
-			return nil, err
+			return err
 		} else if !exists {
 			break
 		}
 
+		// The rtree bounds are rounded to 32-bit floats, so check the
+		// exact envelope before decoding the geometry
 		fid := FeatureId(stmt.ColumnInt64(0))
-
-		var gm geom.Geometry
-		read := true
-		if g.Cache != nil {
-			var err error
-			gm, err = g.Cache.Get(fid)
-			if err == nil {
-				read = false
-			}
+		h, _, err := g.header(fid, r.header())
+		if err != nil {
+			return err
 		}
-		if read {
-			var err error
-			r := stmt.ColumnReader(1)
-			gm, err = readGeometry(r, opts)
-			if err != nil {
-				return nil, err
-			}
-			if g.Cache != nil {
-				g.Cache.Set(fid, gm)
-			}
+		if !inEnvelope(&h, xy) {
+			continue
 		}
 
-		p, err := geom.NewPoint(geom.Coordinates{
-			XY: geom.XY{
-				X: l.Lng.Degrees(),
-				Y: l.Lat.Degrees(),
-			},
-		})
+		gm, ok, err := g.intersects(fid, &r, p)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		contains := geom.Intersects(gm, p.AsGeometry())
-		if contains {
-			cols := make([]string, len(g.cols))
-			for i := 0; i < len(g.cols); i++ {
-				cols[i] = stmt.ColumnText(2 + i)
+
+		if ok {
+			if !fn(stmt, fid, gm) {
+				break
 			}
-			return cols, nil
 		}
 	}
 
-	return nil, ErrNotFound
+	return nil
 }
 
-func readGeometry(r io.Reader, opts []geom.ConstructorOption) (geom.Geometry, error) {
-	var g geom.Geometry
+// orderSQL returns the ORDER BY clause of Order, if it is set
+func (g *GeoPackage) orderSQL() (string, error) {
+	if g.Order.Column == "" {
+		return "", nil
+	}
+	if g.Order.Direction != Asc && g.Order.Direction != Desc {
+		return "", errors.New("invalid order direction")
+	}
+	col, err := g.column(g.Order.Column)
+	if err != nil {
+		return "", fmt.Errorf("invalid order: %w", err)
+	}
+	return ` ORDER BY ` + sqlutil.QuoteIdent(col) + ` ` + string(g.Order.Direction), nil
+}
+
+// geometry returns the geometry of the feature fid, decoding it from the
+// geometry blob read by r if it is not cached.
+func (g *GeoPackage) geometry(fid FeatureId, r *blobReader) (geom.Geometry, error) {
+	if g.Cache != nil {
+		gm, err := g.Cache.Get(fid)
+		if err == nil {
+			return gm, nil
+		}
+	}
 
-	h, err := binary.Read(r)
+	gm, err := g.decode(fid, r.blob())
 	if err != nil {
-		return g, err
+		return gm, err
+	}
+	if g.Cache != nil {
+		g.Cache.Set(fid, gm)
 	}
+	return gm, nil
+}
 
-	if h.Empty() {
-		return g, nil
+// intersects returns the geometry of the feature fid, like geometry, and
+// whether it intersects the point p. If Prepare is set and Cache is a
+// PreparedCache, the test uses the cached PreparedGeometry of the feature.
+func (g *GeoPackage) intersects(fid FeatureId, r *blobReader, p geom.Geometry) (geom.Geometry, bool, error) {
+	pc, ok := g.Cache.(PreparedCache)
+	if !g.Prepare || !ok {
+		gm, err := g.geometry(fid, r)
+		if err != nil {
+			return gm, false, err
+		}
+		return gm, geom.Intersects(gm, p), nil
 	}
 
-	b, err := io.ReadAll(r)
+	pg, err := pc.GetPrepared(fid)
 	if err != nil {
-		return g, err
+		gm, err := g.decode(fid, r.blob())
+		if err != nil {
+			return gm, false, err
+		}
+		pg = Prepare(gm)
+		pc.SetPrepared(fid, pg)
 	}
+	xy, _ := p.MustAsPoint().XY()
+	return pg.Geometry(), pg.ContainsXY(xy), nil
+}
 
-	switch {
-	case h.Type() == binary.StandardType:
-		g, err = geom.UnmarshalWKB(b, opts...)
-	case h.Type() == binary.ExtendedType && bytes.Equal(h.ExtensionCode, binary.ExtensionTWKB):
-		g, err = geom.UnmarshalTWKB(b, opts...)
-	default:
-		return g, errors.New("unsupported geometry type")
+// inEnvelope reports whether xy may be contained in the geometry with the
+// header h, based on its envelope. It returns true if the header has no
+// envelope.
+func inEnvelope(h *binary.Header, xy geom.XY) bool {
+	if h.EnvelopeContentsIndicatorCode().Size() == 0 {
+		return true
+	}
+	return h.Envelope.ContainsXY(xy.X, xy.Y)
+}
+
+// decode decodes the geometry of the feature fid from the geometry blob b
+func (g *GeoPackage) decode(fid FeatureId, b []byte) (geom.Geometry, error) {
+	var opts []geom.ConstructorOption
+	if !g.Validate {
+		opts = skipValidationOpts
+	}
+	h, n, err := g.header(fid, b)
+	if err != nil {
+		return geom.Geometry{}, err
+	}
+	gm, err := binary.UnmarshalPayload(&h, b[n:], opts...)
+	if err == nil && g.Strict {
+		err = h.ValidateGeometry(gm)
+		if err == nil {
+			err = h.ValidateEnvelope(gm, b[n:])
+		}
 	}
 	if err != nil {
-		return g, err
+		return gm, &FeatureError{Id: fid, Err: err}
 	}
+	return gm, nil
+}
 
-	return g, nil
+// maxHeaderSize is the size of the largest geometry blob header, with an
+// XYZM envelope and an extension code
+const maxHeaderSize = 8 + 64 + 4
+
+// blobReader copies the geometry blob in the column col of the current
+// row of stmt into a reused buffer. Only the header is copied to check the
+// envelope, the whole blob only if the geometry needs to be decoded.
+type blobReader struct {
+	stmt *sqlite.Stmt
+	col  int
+	buf  []byte
+}
+
+// header returns the start of the blob, long enough to parse its header
+func (r *blobReader) header() []byte {
+	n := r.stmt.ColumnLen(r.col)
+	if n > maxHeaderSize {
+		n = maxHeaderSize
+	}
+	return r.read(n)
+}
+
+// blob returns the whole blob
+func (r *blobReader) blob() []byte {
+	return r.read(r.stmt.ColumnLen(r.col))
+}
+
+func (r *blobReader) read(n int) []byte {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	r.stmt.ColumnBytes(r.col, r.buf)
+	return r.buf
+}
+
+// readText returns the selected columns of the current row of stmt
+// as text, starting at column offset
+func (g *GeoPackage) readText(stmt *sqlite.Stmt, offset int) []string {
+	cols := make([]string, len(g.cols))
+	for i := 0; i < len(g.cols); i++ {
+		cols[i] = stmt.ColumnText(offset + i)
+	}
+	return cols
 }
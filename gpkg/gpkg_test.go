@@ -1,10 +1,21 @@
 package gpkg
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
 )
 
 type testCase struct {
@@ -304,11 +315,21 @@ var geopackages = []struct {
 	},
 }
 
+// skipMissing skips the test if the dataset at path is not available,
+// see https://github.com/SmilyOrg/tinygpkg-data
+func skipMissing(tb testing.TB, path string) {
+	tb.Helper()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		tb.Skipf("dataset %s not found", path)
+	}
+}
+
 func TestReverseGeocode(t *testing.T) {
 
 	for _, db := range geopackages {
 		t.Run(db.name, func(t *testing.T) {
-			g, err := Open(db.path, db.table, db.nameCol)
+			skipMissing(t, db.path)
+			g, err := Open(db.path, db.table, []string{db.nameCol})
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -322,7 +343,10 @@ func TestReverseGeocode(t *testing.T) {
 					} else if !tc.notFound && err != nil {
 						t.Fatal(err)
 					}
-					if got != tc.want {
+					if tc.notFound {
+						return
+					}
+					if len(got) != 1 || got[0] != tc.want {
 						t.Errorf("got %q, want %q", got, tc.want)
 					}
 				})
@@ -345,7 +369,8 @@ func BenchmarkReverseGeocode(b *testing.B) {
 		b.Run("opts="+name, func(b *testing.B) {
 			for _, db := range geopackages {
 				b.Run("dataset="+db.name, func(b *testing.B) {
-					g, err := Open(db.path, db.table, db.nameCol)
+					skipMissing(b, db.path)
+					g, err := Open(db.path, db.table, []string{db.nameCol})
 					if err != nil {
 						b.Fatal(err)
 					}
@@ -366,3 +391,489 @@ func BenchmarkReverseGeocode(b *testing.B) {
 		})
 	}
 }
+
+type testFeature struct {
+	wkt      string
+	twkb     bool
+	envelope *binary.Envelope
+	// corrupt modifies the encoded geometry blob before it is inserted
+	corrupt func(b []byte)
+	name    string
+	rank    int64
+	area    float64
+	code    []byte
+}
+
+// testFeatures are small overlapping squares, "outer" containing "inner",
+// with "east" stored as TWKB.
+var testFeatures = []testFeature{
+	{wkt: "POLYGON((0 0,10 0,10 10,0 10,0 0))", name: "outer", rank: 1, area: 100},
+	{wkt: "POLYGON((2 2,4 2,4 4,2 4,2 2))", name: "inner", rank: 2, area: 4, code: []byte{0x01}},
+	{wkt: "POLYGON((20 0,30 0,30 10,20 10,20 0))", twkb: true, name: "east", rank: 3, area: 100},
+}
+
+// createTestGeoPackage writes a minimal GeoPackage with a "places" table
+// containing the features and returns its path. Unlike testgpkg.Create,
+// it writes the blobs by hand, so that they can mix encodings, have
+// arbitrary envelopes and be corrupted.
+func createTestGeoPackage(t testing.TB, features []testFeature) string {
+	t.Helper()
+	return createTestGeoPackageSchema(t, testSchema{
+		fidCol:  "fid",
+		geomCol: "geom",
+	}, features)
+}
+
+// testSchema defines the column names and spatial reference system of
+// the test "places" table. The SRS defaults to EPSG:4326.
+type testSchema struct {
+	fidCol        string
+	geomCol       string
+	srsId         int32
+	srsDefinition string
+}
+
+// createTestGeoPackageSchema is like createTestGeoPackage, but with
+// custom primary key and geometry column names.
+func createTestGeoPackageSchema(t testing.TB, schema testSchema, features []testFeature) string {
+	t.Helper()
+	if schema.srsId == 0 {
+		schema.srsId = 4326
+	}
+	if schema.srsDefinition == "" {
+		schema.srsDefinition = "undefined"
+	}
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	conn, err := sqlite.OpenConn(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	srsId := strconv.Itoa(int(schema.srsId))
+	err = sqlitex.ExecuteScript(conn, strings.NewReplacer("{fid}", schema.fidCol, "{geom}", schema.geomCol, "{srs}", srsId).Replace(`
+		CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL,
+			srs_id INTEGER PRIMARY KEY,
+			organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL,
+			definition TEXT NOT NULL,
+			description TEXT
+		);
+		INSERT INTO gpkg_spatial_ref_sys VALUES
+			('WGS 84 geodetic', 4326, 'EPSG', 4326, 'undefined', NULL);
+		CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			data_type TEXT NOT NULL,
+			identifier TEXT,
+			srs_id INTEGER
+		);
+		INSERT INTO gpkg_contents VALUES ('places', 'features', 'places', {srs});
+		CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL,
+			z TINYINT NOT NULL,
+			m TINYINT NOT NULL
+		);
+		INSERT INTO gpkg_geometry_columns VALUES ('places', '{geom}', 'POLYGON', {srs}, 0, 0);
+		CREATE TABLE places (
+			{fid} INTEGER PRIMARY KEY AUTOINCREMENT,
+			{geom} BLOB,
+			name TEXT,
+			rank INTEGER,
+			area REAL,
+			code BLOB
+		);
+		CREATE VIRTUAL TABLE rtree_places_{geom} USING rtree(id, minx, maxx, miny, maxy);
+	`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.srsId != 4326 {
+		err = sqlitex.Execute(conn, `INSERT INTO gpkg_spatial_ref_sys VALUES ('test', ?, 'EPSG', ?, ?, NULL)`, &sqlitex.ExecOptions{
+			Args: []any{schema.srsId, schema.srsId, schema.srsDefinition},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range features {
+		g, err := geom.UnmarshalWKT(f.wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := &binary.Header{
+			HeaderTop: binary.HeaderTop{
+				Magic: [2]byte{0x47, 0x50},
+				Flags: 0b0000_0001,
+			},
+			HeaderSrs: binary.HeaderSrs{
+				SrsId: schema.srsId,
+			},
+		}
+		var payload []byte
+		if f.twkb {
+			h.SetType(binary.ExtendedType)
+			h.ExtensionCode = binary.ExtensionTWKB
+			payload, err = geom.MarshalTWKB(g, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			payload = g.AsBinary()
+		}
+		var buf bytes.Buffer
+		if f.envelope != nil {
+			h.Envelope = *f.envelope
+			h.SetEnvelopeContentsIndicatorCode(binary.XY)
+		}
+		if err := h.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(payload)
+		if f.corrupt != nil {
+			f.corrupt(buf.Bytes())
+		}
+
+		var code any
+		if f.code != nil {
+			code = f.code
+		}
+		err = sqlitex.Execute(conn, `INSERT INTO places (`+schema.geomCol+`, name, rank, area, code) VALUES (?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+			Args: []any{buf.Bytes(), f.name, f.rank, f.area, code},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		min, max, _ := g.Envelope().MinMaxXYs()
+		err = sqlitex.Execute(conn, `INSERT INTO rtree_places_`+schema.geomCol+` VALUES (?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+			Args: []any{conn.LastInsertRowID(), min.X, max.X, min.Y, max.Y},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestReverseGeocodeAll(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		name  string
+		l     s2.LatLng
+		order Order
+		want  []Feature
+	}{
+		{
+			name: "single",
+			l:    s2.LatLngFromDegrees(8, 8),
+			want: []Feature{{Id: 1, Values: []any{"outer"}}},
+		},
+		{
+			name:  "overlapping asc",
+			l:     s2.LatLngFromDegrees(3, 3),
+			order: Order{Column: "rank", Direction: Asc},
+			want: []Feature{
+				{Id: 1, Values: []any{"outer"}},
+				{Id: 2, Values: []any{"inner"}},
+			},
+		},
+		{
+			name:  "overlapping desc",
+			l:     s2.LatLngFromDegrees(3, 3),
+			order: Order{Column: "rank", Direction: Desc},
+			want: []Feature{
+				{Id: 2, Values: []any{"inner"}},
+				{Id: 1, Values: []any{"outer"}},
+			},
+		},
+		{
+			name: "twkb",
+			l:    s2.LatLngFromDegrees(5, 25),
+			want: []Feature{{Id: 3, Values: []any{"east"}}},
+		},
+		{
+			name: "not found",
+			l:    s2.LatLngFromDegrees(5, 15),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.Order = tt.order
+			got, err := g.ReverseGeocodeAll(context.Background(), tt.l)
+			if tt.want == nil {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d features, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].Id != tt.want[i].Id || !reflect.DeepEqual(got[i].Values, tt.want[i].Values) {
+					t.Errorf("got %v %v, want %v %v", got[i].Id, got[i].Values, tt.want[i].Id, tt.want[i].Values)
+				}
+				if got[i].Geometry.IsEmpty() {
+					t.Errorf("got empty geometry")
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAutoconf(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema testSchema
+	}{
+		{"default", testSchema{fidCol: "fid", geomCol: "geom"}},
+		{"qgis", testSchema{fidCol: "ogc_fid", geomCol: "geometry"}},
+		{"esri", testSchema{fidCol: "objectid", geomCol: "shape"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTestGeoPackageSchema(t, tt.schema, testFeatures)
+			g, err := Open(path, "places", []string{"name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+			if g.fidCol != tt.schema.fidCol {
+				t.Errorf("got primary key %q, want %q", g.fidCol, tt.schema.fidCol)
+			}
+			if g.geomCol != tt.schema.geomCol {
+				t.Errorf("got geometry column %q, want %q", g.geomCol, tt.schema.geomCol)
+			}
+
+			got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != "east" {
+				t.Errorf("got %q, want %q", got, "east")
+			}
+		})
+	}
+}
+
+func TestOpenAutoconfMissingIndex(t *testing.T) {
+	path := createTestGeoPackage(t, testFeatures)
+	conn, err := sqlite.OpenConn(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqlitex.ExecuteTransient(conn, `DROP TABLE rtree_places_geom`, nil)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := Open(path, "places", []string{"name"})
+	if err == nil {
+		g.Close()
+		t.Fatal("got nil error, want missing spatial index error")
+	}
+}
+
+func TestOpenIdentifiers(t *testing.T) {
+	path := createTestGeoPackage(t, testFeatures)
+	tests := []struct {
+		name    string
+		table   string
+		cols    []string
+		wantErr error
+	}{
+		{"valid", "places", []string{"name", "rank"}, nil},
+		{"case insensitive", "PLACES", []string{"NAME"}, nil},
+		{"unknown table", "nowhere", []string{"name"}, ErrUnknownTable},
+		{"injected table", "places; DROP TABLE places", []string{"name"}, ErrUnknownTable},
+		{"unknown column", "places", []string{"name", "missing"}, ErrUnknownColumn},
+		{"injected column", "places", []string{"name FROM places --"}, ErrUnknownColumn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := Open(path, tt.table, tt.cols)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer g.Close()
+			if _, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(8, 8)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDefaultTable(t *testing.T) {
+	path := createTestGeoPackage(t, testFeatures)
+	conn, err := sqlite.OpenConn(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqlitex.ExecuteScript(conn, `
+		CREATE TABLE areas (fid INTEGER PRIMARY KEY, geom BLOB, name TEXT);
+		CREATE VIRTUAL TABLE rtree_areas_geom USING rtree(id, minx, maxx, miny, maxy);
+		INSERT INTO gpkg_contents VALUES ('areas', 'features', 'areas', 4326);
+		INSERT INTO gpkg_geometry_columns VALUES ('areas', 'geom', 'POLYGON', 4326, 0, 0);
+	`, nil)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := DefaultTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Open(path, "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if table != g.table {
+		t.Errorf("got %q, want %q used by Open", table, g.table)
+	}
+}
+
+func TestReverseGeocodeUnknownOrder(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "places", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	g.Order = Order{Column: "rank; DROP TABLE places", Direction: Asc}
+	_, err = g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(8, 8))
+	if !errors.Is(err, ErrUnknownColumn) {
+		t.Errorf("got error %v, want %v", err, ErrUnknownColumn)
+	}
+}
+
+func TestReverseGeocodeCanceled(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "places", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := s2.LatLngFromDegrees(3, 3)
+	queries := []struct {
+		name  string
+		query func() error
+	}{
+		{"ReverseGeocode", func() error {
+			_, err := g.ReverseGeocode(ctx, l)
+			return err
+		}},
+		{"ReverseGeocodeFeature", func() error {
+			_, err := g.ReverseGeocodeFeature(ctx, l)
+			return err
+		}},
+		{"ReverseGeocodeAll", func() error {
+			_, err := g.ReverseGeocodeAll(ctx, l)
+			return err
+		}},
+		{"ReverseGeocodeBatch", func() error {
+			_, err := g.ReverseGeocodeBatch(ctx, []s2.LatLng{l}, 1)
+			return err
+		}},
+		{"BBox", func() error {
+			_, err := g.BBox(ctx, s2.RectFromLatLng(l), false)
+			return err
+		}},
+		{"Within", func() error {
+			_, err := g.Within(ctx, l, 1000, false)
+			return err
+		}},
+	}
+	for _, q := range queries {
+		t.Run(q.name, func(t *testing.T) {
+			// The pool either returns no connection or an interrupted one
+			for i := 0; i < 10; i++ {
+				if err := q.query(); err == nil {
+					t.Fatal("expected error for canceled context")
+				}
+			}
+		})
+	}
+}
+
+func TestReverseGeocodeEnvelope(t *testing.T) {
+	features := []testFeature{
+		{
+			wkt:  "POLYGON((40 0,50 0,50 10,40 10,40 0))",
+			name: "narrow",
+			// the envelope is narrower than the geometry to check that it
+			// is used to reject candidates before decoding
+			envelope: &binary.Envelope{MinX: 40, MaxX: 45, MinY: 0, MaxY: 10},
+		},
+	}
+	g, err := Open(createTestGeoPackage(t, features), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != "narrow" {
+		t.Errorf("got %q, want %q", got, "narrow")
+	}
+
+	_, err = g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 47))
+	if err != ErrNotFound {
+		t.Errorf("got %v, want ErrNotFound outside of envelope", err)
+	}
+}
+
+func TestBlobReader(t *testing.T) {
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, n := range []int{0, 8, maxHeaderSize, 1000} {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(i)
+		}
+		stmt := conn.Prep("SELECT ?")
+		stmt.BindBytes(1, b)
+		if _, err := stmt.Step(); err != nil {
+			t.Fatal(err)
+		}
+		r := blobReader{stmt: stmt, col: 0}
+		wantHeader := b
+		if len(wantHeader) > maxHeaderSize {
+			wantHeader = b[:maxHeaderSize]
+		}
+		if got := r.header(); !bytes.Equal(got, wantHeader) {
+			t.Errorf("%d bytes: header() got %d bytes, want %d", n, len(got), len(wantHeader))
+		}
+		if got := r.blob(); !bytes.Equal(got, b) {
+			t.Errorf("%d bytes: blob() got %d bytes, want %d", n, len(got), len(b))
+		}
+		stmt.Reset()
+	}
+}
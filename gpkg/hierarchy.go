@@ -0,0 +1,166 @@
+package gpkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/golang/geo/s2"
+)
+
+// Level is the administrative level of a layer of a Hierarchy
+type Level int
+
+const (
+	Country Level = iota
+	Region
+	District
+	Locality
+)
+
+func (l Level) String() string {
+	switch l {
+	case Country:
+		return "country"
+	case Region:
+		return "region"
+	case District:
+		return "district"
+	case Locality:
+		return "locality"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// Layer defines the GeoPackage table queried for a Level of a Hierarchy,
+// with the same parameters as Open.
+type Layer struct {
+	Level   Level
+	Path    string
+	Table   string
+	Columns []string
+}
+
+// Address is the result of reverse geocoding a point with a Hierarchy.
+// Levels without a layer or below a level where no feature was found are
+// nil.
+type Address struct {
+	Country  *Feature
+	Region   *Feature
+	District *Feature
+	Locality *Feature
+}
+
+// Feature returns the feature of the address at the level, or nil
+func (a *Address) Feature(level Level) *Feature {
+	switch level {
+	case Country:
+		return a.Country
+	case Region:
+		return a.Region
+	case District:
+		return a.District
+	case Locality:
+		return a.Locality
+	default:
+		return nil
+	}
+}
+
+func (a *Address) set(level Level, f *Feature) {
+	switch level {
+	case Country:
+		a.Country = f
+	case Region:
+		a.Region = f
+	case District:
+		a.District = f
+	case Locality:
+		a.Locality = f
+	}
+}
+
+// Hierarchy reverse geocodes points into an Address by querying one
+// GeoPackage layer per administrative level, from the country down.
+type Hierarchy struct {
+	layers []hierarchyLayer
+}
+
+type hierarchyLayer struct {
+	level Level
+	gpkg  *GeoPackage
+}
+
+// OpenHierarchy opens the GeoPackage of each layer, see Open. Each level
+// can only have a single layer.
+func OpenHierarchy(layers []Layer) (*Hierarchy, error) {
+	h := &Hierarchy{}
+	for _, l := range layers {
+		if l.Level < Country || l.Level > Locality {
+			h.Close()
+			return nil, fmt.Errorf("invalid level %s", l.Level)
+		}
+		if h.Layer(l.Level) != nil {
+			h.Close()
+			return nil, fmt.Errorf("duplicate layer for level %s", l.Level)
+		}
+		g, err := Open(l.Path, l.Table, l.Columns)
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("error opening %s layer: %w", l.Level, err)
+		}
+		h.layers = append(h.layers, hierarchyLayer{level: l.Level, gpkg: g})
+	}
+	if len(h.layers) == 0 {
+		return nil, errors.New("no layers specified")
+	}
+	sort.Slice(h.layers, func(i, j int) bool {
+		return h.layers[i].level < h.layers[j].level
+	})
+	return h, nil
+}
+
+// Layer returns the GeoPackage of the level, e.g. to set its Order, Cache
+// or MaxDistance, or nil if there is no layer for it.
+func (h *Hierarchy) Layer(level Level) *GeoPackage {
+	for _, l := range h.layers {
+		if l.level == level {
+			return l.gpkg
+		}
+	}
+	return nil
+}
+
+func (h *Hierarchy) Close() error {
+	var errs []error
+	for _, l := range h.layers {
+		errs = append(errs, l.gpkg.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// ReverseGeocode returns the address of l with the feature of each layer
+// as returned by ReverseGeocodeFeature, from the highest level down.
+//
+// If no feature is found for a level, the lower levels are skipped and
+// the address found so far is returned. ErrNotFound is only returned if
+// no feature is found for the highest level.
+func (h *Hierarchy) ReverseGeocode(ctx context.Context, l s2.LatLng) (Address, error) {
+	var a Address
+	for i, layer := range h.layers {
+		f, err := layer.gpkg.ReverseGeocodeFeature(ctx, l)
+		if errors.Is(err, ErrNotFound) {
+			if i == 0 {
+				return a, ErrNotFound
+			}
+			break
+		}
+		if err != nil {
+			return a, fmt.Errorf("error reverse geocoding %s: %w", layer.level, err)
+		}
+		a.set(layer.level, &f)
+	}
+	return a, nil
+}
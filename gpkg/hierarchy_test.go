@@ -0,0 +1,100 @@
+package gpkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+func TestHierarchy(t *testing.T) {
+	countries := createTestGeoPackage(t, []testFeature{
+		{wkt: "POLYGON((0 0,10 0,10 10,0 10,0 0))", name: "country"},
+	})
+	regions := createTestGeoPackage(t, []testFeature{
+		{wkt: "POLYGON((0 0,5 0,5 10,0 10,0 0))", name: "west"},
+		{wkt: "POLYGON((5 0,10 0,10 10,5 10,5 0))", name: "east"},
+	})
+	localities := createTestGeoPackage(t, []testFeature{
+		{wkt: "POLYGON((1 1,2 1,2 2,1 2,1 1))", name: "town"},
+		// outside of any region, so it is never returned
+		{wkt: "POLYGON((20 20,21 20,21 21,20 21,20 20))", name: "island"},
+	})
+
+	h, err := OpenHierarchy([]Layer{
+		{Level: Locality, Path: localities, Columns: []string{"name"}},
+		{Level: Country, Path: countries, Columns: []string{"name"}},
+		{Level: Region, Path: regions, Columns: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	name := func(f *Feature) string {
+		if f == nil {
+			return ""
+		}
+		return f.Values[0].(string)
+	}
+
+	tests := []struct {
+		name     string
+		l        s2.LatLng
+		want     [4]string
+		notFound bool
+	}{
+		{"all levels", s2.LatLngFromDegrees(1.5, 1.5), [4]string{"country", "west", "", "town"}, false},
+		{"no locality", s2.LatLngFromDegrees(5, 8), [4]string{"country", "east", "", ""}, false},
+		{"skipped below not found", s2.LatLngFromDegrees(20.5, 20.5), [4]string{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := h.ReverseGeocode(context.Background(), tt.l)
+			if tt.notFound {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var got [4]string
+			for level := Country; level <= Locality; level++ {
+				got[level] = name(a.Feature(level))
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenHierarchy_Errors(t *testing.T) {
+	path := createTestGeoPackage(t, testFeatures)
+	tests := []struct {
+		name   string
+		layers []Layer
+	}{
+		{"no layers", nil},
+		{"duplicate level", []Layer{
+			{Level: Country, Path: path, Columns: []string{"name"}},
+			{Level: Country, Path: path, Columns: []string{"name"}},
+		}},
+		{"invalid level", []Layer{
+			{Level: Locality + 1, Path: path, Columns: []string{"name"}},
+		}},
+		{"unknown column", []Layer{
+			{Level: Country, Path: path, Columns: []string{"name"}},
+			{Level: Region, Path: path, Columns: []string{"missing"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := OpenHierarchy(tt.layers)
+			if err == nil {
+				h.Close()
+				t.Error("OpenHierarchy() expected error")
+			}
+		})
+	}
+}
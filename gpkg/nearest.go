@@ -0,0 +1,204 @@
+package gpkg
+
+import (
+	"math"
+
+	"github.com/golang/geo/r1"
+	"github.com/golang/geo/s1"
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+)
+
+// earthRadius is the mean radius of the Earth in meters
+const earthRadius = 6371008.8
+
+// nearest returns the feature nearest to l within maxDist meters,
+// or ErrNotFound if there is none. The returned feature has no Values.
+func (g *GeoPackage) nearest(conn *sqlite.Conn, l s2.LatLng, maxDist float64) (Feature, error) {
+	sql := `
+		SELECT ` + sqlutil.QuoteIdent(g.fidCol) + `, ` + sqlutil.QuoteIdent(g.geomCol) + `
+		FROM ` + sqlutil.QuoteIdent(g.table) + `
+		WHERE ` + sqlutil.QuoteIdent(g.fidCol) + ` IN (
+			SELECT id
+			FROM ` + sqlutil.QuoteIdent(g.rtree) + `
+			WHERE
+				maxx >= :minx AND minx <= :maxx AND
+				maxy >= :miny AND miny <= :maxy
+		)`
+
+	filters, err := g.filterSQL()
+	if err != nil {
+		return Feature{}, err
+	}
+	sql += filters
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+	g.bindFilters(stmt)
+
+	found := false
+	var best Feature
+	r := blobReader{stmt: stmt, col: 1}
+	best.Distance = maxDist
+
+	for _, b := range g.searchBounds(l, maxDist) {
+		stmt.Reset()
+		stmt.BindFloat(1, b.minX)
+		stmt.BindFloat(2, b.maxX)
+		stmt.BindFloat(3, b.minY)
+		stmt.BindFloat(4, b.maxY)
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				return Feature{}, err
+			} else if !exists {
+				break
+			}
+
+			fid := FeatureId(stmt.ColumnInt64(0))
+			gm, err := g.geometry(fid, &r)
+			if err != nil {
+				return Feature{}, err
+			}
+
+			lgm, err := g.Unproject(gm)
+			if err != nil {
+				return Feature{}, &FeatureError{Id: fid, Err: err}
+			}
+			d, ok := distance(l, lgm)
+			if ok && d <= best.Distance {
+				best.Id = fid
+				best.Columns = g.cols
+				best.Geometry = gm
+				best.Distance = d
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return Feature{}, ErrNotFound
+	}
+	return best, nil
+}
+
+// row calls read with the statement positioned on the row of the feature
+// fid, with the selected columns starting at column 0.
+func (g *GeoPackage) row(conn *sqlite.Conn, fid FeatureId, read func(stmt *sqlite.Stmt, offset int)) error {
+	sql := `
+		SELECT ` + g.colSelect + `
+		FROM ` + sqlutil.QuoteIdent(g.table) + `
+		WHERE ` + sqlutil.QuoteIdent(g.fidCol) + ` = :fid`
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+
+	stmt.BindInt64(1, int64(fid))
+	if exists, err := stmt.Step(); err != nil {
+		return err
+	} else if !exists {
+		return ErrNotFound
+	}
+	read(stmt, 0)
+	return nil
+}
+
+// searchRects returns the longitude/latitude rectangles covering all
+// points within dist meters of l, split at the antimeridian.
+func searchRects(l s2.LatLng, dist float64) []s2.Rect {
+	a := dist / earthRadius
+	lat := r1.Interval{Lo: l.Lat.Radians() - a, Hi: l.Lat.Radians() + a}
+	lng := s1.FullInterval()
+	if lat.Lo > -math.Pi/2 && lat.Hi < math.Pi/2 {
+		if s := math.Sin(a) / math.Cos(l.Lat.Radians()); s < 1 {
+			lng = s1.IntervalFromEndpoints(l.Lng.Radians(), l.Lng.Radians()).Expanded(math.Asin(s))
+		}
+	}
+	lat = lat.Intersection(r1.Interval{Lo: -math.Pi / 2, Hi: math.Pi / 2})
+	return splitRect(s2.Rect{Lat: lat, Lng: lng})
+}
+
+// splitRect returns r split at the antimeridian if it crosses it
+func splitRect(r s2.Rect) []s2.Rect {
+	if !r.Lng.IsInverted() {
+		return []s2.Rect{r}
+	}
+	return []s2.Rect{
+		{Lat: r.Lat, Lng: s1.Interval{Lo: r.Lng.Lo, Hi: math.Pi}},
+		{Lat: r.Lat, Lng: s1.Interval{Lo: -math.Pi, Hi: r.Lng.Hi}},
+	}
+}
+
+// distance returns the great-circle distance in meters from l to the
+// closest point of gm, or false if gm is empty.
+func distance(l s2.LatLng, gm geom.Geometry) (float64, bool) {
+	p := s2.PointFromLatLng(l)
+	min := s1.InfChordAngle()
+	for _, part := range gm.Dump() {
+		switch part.Type() {
+		case geom.TypePoint:
+			xy, ok := part.MustAsPoint().XY()
+			if !ok {
+				continue
+			}
+			d := s2.ChordAngleBetweenPoints(p, pointXY(xy))
+			if d < min {
+				min = d
+			}
+		case geom.TypeLineString:
+			min = sequenceDistance(p, part.MustAsLineString().Coordinates(), min)
+		case geom.TypePolygon:
+			poly := part.MustAsPolygon()
+			if geom.Intersects(part, pointLatLng(l)) {
+				return 0, true
+			}
+			min = sequenceDistance(p, poly.ExteriorRing().Coordinates(), min)
+			for i := 0; i < poly.NumInteriorRings(); i++ {
+				min = sequenceDistance(p, poly.InteriorRingN(i).Coordinates(), min)
+			}
+		}
+	}
+	if min == s1.InfChordAngle() {
+		return 0, false
+	}
+	return min.Angle().Radians() * earthRadius, true
+}
+
+// sequenceDistance returns the smaller of min and the distance from p to
+// the line string formed by seq.
+func sequenceDistance(p s2.Point, seq geom.Sequence, min s1.ChordAngle) s1.ChordAngle {
+	n := seq.Length()
+	if n == 0 {
+		return min
+	}
+	a := pointXY(seq.GetXY(0))
+	if n == 1 {
+		if d := s2.ChordAngleBetweenPoints(p, a); d < min {
+			min = d
+		}
+		return min
+	}
+	for i := 1; i < n; i++ {
+		b := pointXY(seq.GetXY(i))
+		min, _ = s2.UpdateMinDistance(p, a, b, min)
+		a = b
+	}
+	return min
+}
+
+// pointXY returns the s2.Point of a longitude/latitude XY in degrees
+func pointXY(xy geom.XY) s2.Point {
+	return s2.PointFromLatLng(s2.LatLngFromDegrees(xy.Y, xy.X))
+}
+
+// pointLatLng returns the point geometry of l in longitude/latitude degrees
+func pointLatLng(l s2.LatLng) geom.Geometry {
+	// validations are skipped, so there is no error to handle
+	p, _ := geom.XY{
+		X: l.Lng.Degrees(),
+		Y: l.Lat.Degrees(),
+	}.AsPoint(skipValidationOpts...)
+	return p.AsGeometry()
+}
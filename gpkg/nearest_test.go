@@ -0,0 +1,140 @@
+package gpkg
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func TestReverseGeocodeNearest(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	tests := []struct {
+		name        string
+		l           s2.LatLng
+		maxDistance float64
+		want        string
+		wantDist    float64
+		notFound    bool
+	}{
+		{
+			name:        "contained",
+			l:           s2.LatLngFromDegrees(5, 5),
+			maxDistance: 300_000,
+			want:        "outer",
+		},
+		{
+			name:     "disabled",
+			l:        s2.LatLngFromDegrees(5, 12),
+			notFound: true,
+		},
+		{
+			name:        "nearest west",
+			l:           s2.LatLngFromDegrees(5, 12),
+			maxDistance: 300_000,
+			want:        "outer",
+			wantDist:    2 * math.Pi / 180 * earthRadius * math.Cos(5*math.Pi/180),
+		},
+		{
+			name:        "nearest east",
+			l:           s2.LatLngFromDegrees(5, 17),
+			maxDistance: 1_000_000,
+			want:        "east",
+			wantDist:    3 * math.Pi / 180 * earthRadius * math.Cos(5*math.Pi/180),
+		},
+		{
+			name:        "too far",
+			l:           s2.LatLngFromDegrees(5, 12),
+			maxDistance: 100_000,
+			notFound:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g.MaxDistance = tt.maxDistance
+			got, err := g.ReverseGeocodeFeature(context.Background(), tt.l)
+			if tt.notFound {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Values) != 1 || got.Values[0] != tt.want {
+				t.Errorf("got %q, want %q", got.Values, tt.want)
+			}
+			if math.Abs(got.Distance-tt.wantDist) > 1000 {
+				t.Errorf("got distance %f, want %f", got.Distance, tt.wantDist)
+			}
+		})
+	}
+}
+
+func TestSearchRects(t *testing.T) {
+	tests := []struct {
+		name string
+		l    s2.LatLng
+		dist float64
+		want int
+	}{
+		{"single", s2.LatLngFromDegrees(45, 15), 100_000, 1},
+		{"antimeridian", s2.LatLngFromDegrees(0, 179.9), 100_000, 2},
+		{"pole", s2.LatLngFromDegrees(89.9, 0), 100_000, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rects := searchRects(tt.l, tt.dist)
+			if len(rects) != tt.want {
+				t.Fatalf("got %d rects, want %d", len(rects), tt.want)
+			}
+			contains := false
+			for _, r := range rects {
+				if r.ContainsLatLng(tt.l) {
+					contains = true
+				}
+			}
+			if !contains {
+				t.Errorf("rects %v do not contain %v", rects, tt.l)
+			}
+		})
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name   string
+		wkt    string
+		want   float64
+		wantOk bool
+	}{
+		{"point", "POINT(1 0)", math.Pi / 180 * earthRadius, true},
+		{"line", "LINESTRING(1 -1,1 1)", math.Pi / 180 * earthRadius, true},
+		{"inside polygon", "POLYGON((-1 -1,1 -1,1 1,-1 1,-1 -1))", 0, true},
+		{"empty", "POLYGON EMPTY", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gm, err := geom.UnmarshalWKT(tt.wkt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := distance(s2.LatLngFromDegrees(0, 0), gm)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if math.Abs(got-tt.want) > 1 {
+				t.Errorf("got %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package gpkg
+
+import (
+	"math"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// PreparedCache is a GeometryCache that can also hold prepared
+// geometries, see GeoPackage.Prepare.
+type PreparedCache interface {
+	GeometryCache
+	GetPrepared(fid FeatureId) (*PreparedGeometry, error)
+	SetPrepared(fid FeatureId, p *PreparedGeometry) error
+}
+
+// PreparedGeometry is a geometry with an index of its polygon edges for
+// fast point-in-polygon tests.
+//
+// The edges are bucketed into horizontal bands, so a test only needs to
+// check the edges of the band containing the point instead of all of
+// them.
+type PreparedGeometry struct {
+	g         geom.Geometry
+	polygonal bool
+	env       geom.Envelope
+	minY      float64
+	bandH     float64
+	bands     [][]edge
+	edges     int
+}
+
+type edge struct {
+	a, b geom.XY
+}
+
+// maxBandEdges is the target average number of edges per band
+const maxBandEdges = 8
+
+// maxBands is the maximum number of bands of a PreparedGeometry
+const maxBands = 4096
+
+// Prepare indexes the polygons of g for fast point-in-polygon tests.
+// Geometries other than polygons and multipolygons are not indexed.
+func Prepare(g geom.Geometry) *PreparedGeometry {
+	p := &PreparedGeometry{
+		g:   g,
+		env: g.Envelope(),
+	}
+	if g.Type() != geom.TypePolygon && g.Type() != geom.TypeMultiPolygon {
+		return p
+	}
+	min, max, ok := p.env.MinMaxXYs()
+	if !ok {
+		return p
+	}
+	p.polygonal = true
+
+	var rings []geom.Sequence
+	for _, part := range g.Dump() {
+		poly := part.MustAsPolygon()
+		rings = append(rings, poly.ExteriorRing().Coordinates())
+		for i := 0; i < poly.NumInteriorRings(); i++ {
+			rings = append(rings, poly.InteriorRingN(i).Coordinates())
+		}
+	}
+	for _, r := range rings {
+		if n := r.Length(); n > 1 {
+			p.edges += n - 1
+		}
+	}
+
+	n := p.edges/maxBandEdges + 1
+	if n > maxBands {
+		n = maxBands
+	}
+	p.minY = min.Y
+	p.bandH = (max.Y - min.Y) / float64(n)
+	if p.bandH == 0 {
+		n = 1
+	}
+	p.bands = make([][]edge, n)
+	for _, r := range rings {
+		for i := 1; i < r.Length(); i++ {
+			e := edge{a: r.GetXY(i - 1), b: r.GetXY(i)}
+			lo, hi := p.band(math.Min(e.a.Y, e.b.Y)), p.band(math.Max(e.a.Y, e.b.Y))
+			for b := lo; b <= hi; b++ {
+				p.bands[b] = append(p.bands[b], e)
+			}
+		}
+	}
+	return p
+}
+
+// Geometry returns the prepared geometry.
+func (p *PreparedGeometry) Geometry() geom.Geometry {
+	return p.g
+}
+
+// ContainsXY reports whether the point xy intersects the geometry, i.e.
+// whether it is inside the geometry or on its boundary.
+func (p *PreparedGeometry) ContainsXY(xy geom.XY) bool {
+	if !p.polygonal {
+		pt, err := xy.AsPoint(skipValidationOpts...)
+		if err != nil {
+			return false
+		}
+		return geom.Intersects(p.g, pt.AsGeometry())
+	}
+	if !p.env.Contains(xy) {
+		return false
+	}
+	inside := false
+	for _, e := range p.bands[p.band(xy.Y)] {
+		if onSegment(xy, e) {
+			return true
+		}
+		if (e.a.Y > xy.Y) != (e.b.Y > xy.Y) {
+			x := e.a.X + (xy.Y-e.a.Y)*(e.b.X-e.a.X)/(e.b.Y-e.a.Y)
+			if xy.X < x {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// size estimates the memory used by the index in bytes
+func (p *PreparedGeometry) size() int64 {
+	const edgeSize = 32
+	const bandSize = 24
+	var n int64
+	for _, b := range p.bands {
+		n += int64(len(b))
+	}
+	return n*edgeSize + int64(len(p.bands))*bandSize
+}
+
+// band returns the index of the band containing y
+func (p *PreparedGeometry) band(y float64) int {
+	if p.bandH == 0 {
+		return 0
+	}
+	b := int((y - p.minY) / p.bandH)
+	if b < 0 {
+		return 0
+	}
+	if b >= len(p.bands) {
+		return len(p.bands) - 1
+	}
+	return b
+}
+
+// onSegment reports whether xy lies on the edge e
+func onSegment(xy geom.XY, e edge) bool {
+	if xy.X < math.Min(e.a.X, e.b.X) || xy.X > math.Max(e.a.X, e.b.X) ||
+		xy.Y < math.Min(e.a.Y, e.b.Y) || xy.Y > math.Max(e.a.Y, e.b.Y) {
+		return false
+	}
+	return e.b.Sub(e.a).Cross(xy.Sub(e.a)) == 0
+}
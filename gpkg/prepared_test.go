@@ -0,0 +1,112 @@
+package gpkg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// circleWKT returns a polygon approximating a circle with n vertices
+func circleWKT(cx, cy, r float64, n int) string {
+	var b strings.Builder
+	b.WriteString("POLYGON((")
+	for i := 0; i <= n; i++ {
+		a := 2 * math.Pi * float64(i%n) / float64(n)
+		if i > 0 {
+			b.WriteString(",")
+		}
+		// vary the radius to get a concave shape
+		rr := r * (1 + 0.3*math.Sin(7*a))
+		fmt.Fprintf(&b, "%f %f", cx+rr*math.Cos(a), cy+rr*math.Sin(a))
+	}
+	b.WriteString("))")
+	return b.String()
+}
+
+func TestPreparedGeometry_ContainsXY(t *testing.T) {
+	wkts := []string{
+		"POLYGON((0 0,10 0,10 10,0 10,0 0))",
+		"POLYGON((0 0,10 0,10 10,0 10,0 0),(2 2,8 2,8 8,2 8,2 2))",
+		"MULTIPOLYGON(((0 0,4 0,4 4,0 4,0 0)),((6 6,10 6,10 10,6 10,6 6)))",
+		"POLYGON((0 0,10 0,5 5,10 10,0 10,0 0))",
+		circleWKT(5, 5, 4, 1000),
+		"LINESTRING(0 0,10 10)",
+		"POLYGON EMPTY",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for _, wkt := range wkts {
+		g, err := geom.UnmarshalWKT(wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Prepare(g)
+
+		var xys []geom.XY
+		for i := 0; i < 1000; i++ {
+			xys = append(xys, geom.XY{X: rnd.Float64()*12 - 1, Y: rnd.Float64()*12 - 1})
+		}
+		// boundary points
+		xys = append(xys, geom.XY{X: 0, Y: 0}, geom.XY{X: 5, Y: 0}, geom.XY{X: 10, Y: 5}, geom.XY{X: 5, Y: 5})
+
+		for _, xy := range xys {
+			pt, _ := xy.AsPoint()
+			want := geom.Intersects(g, pt.AsGeometry())
+			if got := p.ContainsXY(xy); got != want {
+				t.Errorf("%.40s: ContainsXY(%v) = %v, want %v", wkt, xy, got, want)
+			}
+		}
+	}
+}
+
+func TestReverseGeocodePrepared(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cache := NewLRUCache(1 << 20)
+	g.Cache = cache
+	g.Prepare = true
+	g.Order = Order{Column: "rank", Direction: Desc}
+
+	for i := 0; i < 2; i++ {
+		got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(3, 3))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0] != "inner" {
+			t.Errorf("got %q, want %q", got, "inner")
+		}
+	}
+	if _, err := cache.GetPrepared(2); err != nil {
+		t.Errorf("got %v, want prepared geometry in cache", err)
+	}
+}
+
+func BenchmarkPreparedGeometry(b *testing.B) {
+	g, err := geom.UnmarshalWKT(circleWKT(0, 0, 1, 10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	xy := geom.XY{X: 0.5, Y: 0.25}
+	pt, _ := xy.AsPoint()
+
+	b.Run("intersects", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			geom.Intersects(g, pt.AsGeometry())
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		p := Prepare(g)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			p.ContainsXY(xy)
+		}
+	})
+}
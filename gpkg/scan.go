@@ -0,0 +1,160 @@
+package gpkg
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/golang/geo/s2"
+)
+
+// tagName is the struct tag used to map columns to struct fields
+const tagName = "gpkg"
+
+// Columns returns the column names of the fields of the struct T tagged
+// with `gpkg:"<column>"`, in field order, for use with Open.
+//
+// Example:
+//
+//	type Country struct {
+//		Name string `gpkg:"NAME"`
+//		Code string `gpkg:"ISO_A3"`
+//	}
+//
+//	g, err := gpkg.Open(path, table, gpkg.Columns[Country]())
+func Columns[T any]() []string {
+	var cols []string
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		col, ok := fieldColumn(t.Field(i))
+		if ok {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
+
+// Scan copies the values of the feature into the fields of the struct
+// pointed to by dst tagged with `gpkg:"<column>"`.
+//
+// Columns are matched by name, so the order of the columns passed to Open
+// does not matter. Scan returns an error if a tagged column is missing
+// from the feature or its value cannot be assigned to the field. NULL
+// values set the field to its zero value.
+func (f Feature) Scan(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("scan destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		col, ok := fieldColumn(t.Field(i))
+		if !ok {
+			continue
+		}
+		value, ok := f.Value(col)
+		if !ok {
+			return fmt.Errorf("scan column %s: column not selected", col)
+		}
+		if err := assign(v.Field(i), value); err != nil {
+			return fmt.Errorf("scan column %s into field %s: %w", col, t.Field(i).Name, err)
+		}
+	}
+	return nil
+}
+
+// ReverseGeocodeAs reverse geocodes l like ReverseGeocodeFeature and scans
+// the returned feature into a new T. The GeoPackage should be opened with
+// the columns returned by Columns[T].
+func ReverseGeocodeAs[T any](ctx context.Context, g *GeoPackage, l s2.LatLng) (T, error) {
+	var v T
+	f, err := g.ReverseGeocodeFeature(ctx, l)
+	if err != nil {
+		return v, err
+	}
+	err = f.Scan(&v)
+	return v, err
+}
+
+// fieldColumn returns the column name of a struct field from its tag
+func fieldColumn(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	col, ok := f.Tag.Lookup(tagName)
+	if !ok || col == "" || col == "-" {
+		return "", false
+	}
+	return col, true
+}
+
+// assign sets the field v to the column value, converting it to the
+// type of the field where this is lossless
+func assign(v reflect.Value, value any) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		p := reflect.New(v.Type().Elem())
+		if err := assign(p.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("cannot assign %T to %s", value, v.Type())
+		}
+		v.Set(rv)
+		return nil
+	}
+
+	switch x := value.(type) {
+	case int64:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(x) {
+				return fmt.Errorf("value %d overflows %s", x, v.Type())
+			}
+			v.SetInt(x)
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if x < 0 || v.OverflowUint(uint64(x)) {
+				return fmt.Errorf("value %d overflows %s", x, v.Type())
+			}
+			v.SetUint(uint64(x))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(x))
+			return nil
+		}
+	case float64:
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(x)
+			return nil
+		}
+	case string:
+		if v.Kind() == reflect.String {
+			v.SetString(x)
+			return nil
+		}
+	case []byte:
+		if v.Kind() == reflect.String {
+			v.SetString(string(x))
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(x)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot assign %T to %s", value, v.Type())
+}
@@ -0,0 +1,115 @@
+package gpkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+type testPlace struct {
+	Name    string  `gpkg:"name"`
+	Rank    int     `gpkg:"rank"`
+	Area    float32 `gpkg:"area"`
+	Code    *[]byte `gpkg:"code"`
+	Ignored string
+	Skipped string `gpkg:"-"`
+}
+
+func TestColumns(t *testing.T) {
+	got := Columns[testPlace]()
+	want := []string{"name", "rank", "area", "code"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := Columns[int](); got != nil {
+		t.Errorf("got %q for non-struct, want nil", got)
+	}
+}
+
+func TestReverseGeocodeAs(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", Columns[testPlace]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Order = Order{Column: "rank", Direction: Desc}
+
+	got, err := ReverseGeocodeAs[testPlace](context.Background(), g, s2.LatLngFromDegrees(3, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := []byte{0x01}
+	want := testPlace{Name: "inner", Rank: 2, Area: 4, Code: &code}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	got, err = ReverseGeocodeAs[testPlace](context.Background(), g, s2.LatLngFromDegrees(8, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != nil {
+		t.Errorf("got code %v, want nil", got.Code)
+	}
+}
+
+func TestFeature_Scan(t *testing.T) {
+	f := Feature{
+		Columns: []string{"name", "rank"},
+		Values:  []any{"outer", int64(300)},
+	}
+	tests := []struct {
+		name    string
+		dst     any
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			dst: &struct {
+				Rank int64 `gpkg:"rank"`
+			}{},
+		},
+		{
+			name: "any",
+			dst: &struct {
+				Rank any `gpkg:"rank"`
+			}{},
+		},
+		{
+			name: "missing column",
+			dst: &struct {
+				Area float64 `gpkg:"area"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "overflow",
+			dst: &struct {
+				Rank uint8 `gpkg:"rank"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "type mismatch",
+			dst: &struct {
+				Name int `gpkg:"name"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name:    "not a pointer",
+			dst:     struct{}{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := f.Scan(tt.dst)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
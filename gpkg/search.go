@@ -0,0 +1,205 @@
+package gpkg
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+)
+
+// BBox returns all features intersecting the longitude/latitude
+// rectangle r, in the order specified by Order, or ErrNotFound if there
+// are none. Rectangles crossing the antimeridian are supported, with the
+// features on either side of it ordered separately.
+//
+// The geometry of the features is only returned if withGeometry is set,
+// it is decoded either way to test the intersection.
+func (g *GeoPackage) BBox(ctx context.Context, r s2.Rect, withGeometry bool) ([]Feature, error) {
+	conn, err := g.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer g.pool.Put(conn)
+
+	rects := splitRect(r)
+	var areas []geom.Geometry
+	for _, r := range rects {
+		env, err := geom.NewEnvelope([]geom.XY{
+			{X: r.Lo().Lng.Degrees(), Y: r.Lo().Lat.Degrees()},
+			{X: r.Hi().Lng.Degrees(), Y: r.Hi().Lat.Degrees()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		areas = append(areas, env.AsGeometry())
+	}
+
+	var features []Feature
+	err = g.search(conn, g.rectBounds(rects), func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) error {
+		lgm, err := g.Unproject(gm)
+		if err != nil {
+			return &FeatureError{Id: fid, Err: err}
+		}
+		for _, area := range areas {
+			if geom.Intersects(lgm, area) {
+				features = append(features, g.searchFeature(stmt, fid, gm, withGeometry))
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, ErrNotFound
+	}
+	return features, nil
+}
+
+// Within returns all features within radius meters of l, ordered by
+// their Distance from l, or ErrNotFound if there are none. Features
+// containing l have a Distance of zero.
+//
+// The geometry of the features is only returned if withGeometry is set,
+// it is decoded either way to compute the distance.
+func (g *GeoPackage) Within(ctx context.Context, l s2.LatLng, radius float64, withGeometry bool) ([]Feature, error) {
+	conn, err := g.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer g.pool.Put(conn)
+
+	var features []Feature
+	err = g.search(conn, g.searchBounds(l, radius), func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) error {
+		lgm, err := g.Unproject(gm)
+		if err != nil {
+			return &FeatureError{Id: fid, Err: err}
+		}
+		d, ok := distance(l, lgm)
+		if !ok || d > radius {
+			return nil
+		}
+		f := g.searchFeature(stmt, fid, gm, withGeometry)
+		f.Distance = d
+		features = append(features, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(features) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.SliceStable(features, func(i, j int) bool {
+		return features[i].Distance < features[j].Distance
+	})
+	return features, nil
+}
+
+// search calls fn with the statement positioned on the row of each
+// feature matching Filters with an rtree entry intersecting any of the
+// bounds, in the order specified by Order, and its geometry. Features
+// intersecting multiple bounds are only returned once.
+func (g *GeoPackage) search(conn *sqlite.Conn, bs []bounds, fn func(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry) error) error {
+	sql := `
+		SELECT ` + sqlutil.QuoteIdent(g.fidCol) + `, ` + sqlutil.QuoteIdent(g.geomCol) + `, ` + g.colSelect + `
+		FROM ` + sqlutil.QuoteIdent(g.table) + `
+		WHERE ` + sqlutil.QuoteIdent(g.fidCol) + ` IN (
+			SELECT id
+			FROM ` + sqlutil.QuoteIdent(g.rtree) + `
+			WHERE
+				maxx >= :minx AND minx <= :maxx AND
+				maxy >= :miny AND miny <= :maxy
+		)`
+
+	filters, err := g.filterSQL()
+	if err != nil {
+		return err
+	}
+	sql += filters
+
+	order, err := g.orderSQL()
+	if err != nil {
+		return err
+	}
+	sql += order
+
+	stmt := conn.Prep(sql)
+	defer stmt.Reset()
+	g.bindFilters(stmt)
+
+	r := blobReader{stmt: stmt, col: 1}
+	var seen map[FeatureId]bool
+	if len(bs) > 1 {
+		seen = make(map[FeatureId]bool)
+	}
+	for _, b := range bs {
+		stmt.Reset()
+		stmt.BindFloat(1, b.minX)
+		stmt.BindFloat(2, b.maxX)
+		stmt.BindFloat(3, b.minY)
+		stmt.BindFloat(4, b.maxY)
+
+		for {
+			if exists, err := stmt.Step(); err != nil {
+				return err
+			} else if !exists {
+				break
+			}
+
+			fid := FeatureId(stmt.ColumnInt64(0))
+			if seen[fid] {
+				continue
+			}
+
+			h, _, err := g.header(fid, r.header())
+			if err != nil {
+				return err
+			}
+			if !envelopeIntersects(&h, b) {
+				continue
+			}
+			if seen != nil {
+				seen[fid] = true
+			}
+
+			gm, err := g.geometry(fid, &r)
+			if err != nil {
+				return err
+			}
+			if err := fn(stmt, fid, gm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// searchFeature returns the feature of the current row of a search
+func (g *GeoPackage) searchFeature(stmt *sqlite.Stmt, fid FeatureId, gm geom.Geometry, withGeometry bool) Feature {
+	f := Feature{
+		Id:      fid,
+		Columns: g.cols,
+		Values:  readValues(stmt, 2, len(g.cols)),
+	}
+	if withGeometry {
+		f.Geometry = gm
+	}
+	return f
+}
+
+// envelopeIntersects reports whether the geometry with the header h may
+// intersect b, based on its envelope. It returns true if the header has no
+// envelope.
+func envelopeIntersects(h *binary.Header, b bounds) bool {
+	if h.EnvelopeContentsIndicatorCode().Size() == 0 {
+		return true
+	}
+	return h.MaxX >= b.minX && h.MinX <= b.maxX &&
+		h.MaxY >= b.minY && h.MinY <= b.maxY
+}
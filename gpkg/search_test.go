@@ -0,0 +1,153 @@
+package gpkg
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/geo/s2"
+)
+
+func names(fs []Feature) []string {
+	var names []string
+	for _, f := range fs {
+		names = append(names, f.Values[0].(string))
+	}
+	return names
+}
+
+func TestBBox(t *testing.T) {
+	features := append([]testFeature{
+		{wkt: "POLYGON((179 0,180 0,180 1,179 1,179 0))", name: "dateline east"},
+		{wkt: "POLYGON((-180 0,-179 0,-179 1,-180 1,-180 0))", name: "dateline west"},
+	}, testFeatures...)
+	g, err := Open(createTestGeoPackage(t, features), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Order = Order{Column: "rank", Direction: Desc}
+	g.Cache = NewLRUCache(1 << 20)
+
+	tests := []struct {
+		name string
+		r    s2.Rect
+		want []string
+	}{
+		{
+			name: "all",
+			r:    s2.RectFromLatLng(s2.LatLngFromDegrees(-1, -1)).AddPoint(s2.LatLngFromDegrees(11, 31)),
+			want: []string{"east", "inner", "outer"},
+		},
+		{
+			name: "inside outer",
+			r:    s2.RectFromLatLng(s2.LatLngFromDegrees(6, 6)).AddPoint(s2.LatLngFromDegrees(7, 7)),
+			want: []string{"outer"},
+		},
+		{
+			name: "overlapping inner",
+			r:    s2.RectFromLatLng(s2.LatLngFromDegrees(3, 3)).AddPoint(s2.LatLngFromDegrees(7, 7)),
+			want: []string{"inner", "outer"},
+		},
+		{
+			name: "gap",
+			r:    s2.RectFromLatLng(s2.LatLngFromDegrees(2, 12)).AddPoint(s2.LatLngFromDegrees(8, 18)),
+		},
+		{
+			name: "antimeridian",
+			r:    s2.RectFromCenterSize(s2.LatLngFromDegrees(0.5, 180), s2.LatLngFromDegrees(0.5, 1)),
+			want: []string{"dateline east", "dateline west"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := g.BBox(context.Background(), tt.r, true)
+			if tt.want == nil {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := names(fs)
+			if tt.name == "antimeridian" {
+				// the order is only defined on each side
+				sort.Strings(got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, f := range fs {
+				if f.Geometry.IsEmpty() {
+					t.Errorf("got empty geometry for %d", f.Id)
+				}
+			}
+		})
+	}
+
+	fs, err := g.BBox(context.Background(), s2.RectFromLatLng(s2.LatLngFromDegrees(6, 6)), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fs[0].Geometry.IsEmpty() {
+		t.Errorf("got geometry %s, want none", fs[0].Geometry.AsText())
+	}
+	if stats := g.Cache.(*LRUCache).Stats(); stats.Hits == 0 {
+		t.Errorf("got no cache hits, want the cache to be used")
+	}
+}
+
+func TestWithin(t *testing.T) {
+	g, err := Open(createTestGeoPackage(t, testFeatures), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// one degree of longitude at 5°N
+	deg := math.Pi / 180 * earthRadius * math.Cos(5*math.Pi/180)
+
+	tests := []struct {
+		name      string
+		l         s2.LatLng
+		radius    float64
+		want      []string
+		wantDists []float64
+	}{
+		{"containing", s2.LatLngFromDegrees(3, 3), 1000, []string{"inner", "outer"}, []float64{0, 0}},
+		{"between", s2.LatLngFromDegrees(5, 14), 6.5 * deg, []string{"outer", "east"}, []float64{4 * deg, 6 * deg}},
+		{"closer", s2.LatLngFromDegrees(5, 14), 5 * deg, []string{"outer"}, []float64{4 * deg}},
+		{"none", s2.LatLngFromDegrees(5, 15), 1000, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, err := g.Within(context.Background(), tt.l, tt.radius, false)
+			if tt.want == nil {
+				if err != ErrNotFound {
+					t.Fatalf("got %v, want ErrNotFound", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := names(fs)
+			if tt.wantDists[0] == 0 {
+				// features at the same distance are in table order
+				sort.Strings(got)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i, f := range fs {
+				if math.Abs(f.Distance-tt.wantDists[i]) > 1000 {
+					t.Errorf("got distance %f, want %f", f.Distance, tt.wantDists[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package gpkg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+var ErrUnsupportedSrs = errors.New("unsupported srs")
+
+// projection converts between longitude/latitude degrees and the
+// coordinates of a projected coordinate reference system
+type projection interface {
+	forward(lng, lat float64) (x, y float64)
+	inverse(x, y float64) (lng, lat float64)
+}
+
+// WGS 84 and GRS 1980 ellipsoids, the latter used by ETRS89 and NAD83.
+// The datums are treated as equivalent, which is accurate to about a meter.
+const (
+	wgs84A    = 6378137
+	wgs84InvF = 298.257223563
+	grs80InvF = 298.257222101
+)
+
+// newProjection returns the projection of the spatial reference system
+// defined by organization, id and its WKT definition, or nil if it uses
+// longitude/latitude degrees. It returns ErrUnsupportedSrs if the system
+// is neither geographic, Web Mercator nor transverse Mercator in meters,
+// or if its prime meridian is not Greenwich.
+func newProjection(srsId int32, organization string, id int64, definition string) (projection, error) {
+	// srs_id 0 and -1 are reserved for undefined geographic and Cartesian
+	// coordinate systems, the coordinates are used as they are
+	if srsId == 0 || srsId == -1 {
+		return nil, nil
+	}
+	if strings.EqualFold(organization, "EPSG") {
+		switch {
+		case id == 4326:
+			return nil, nil
+		case id == 3857 || id == 3785 || id == 900913:
+			return webMercator{}, nil
+		case id >= 32601 && id <= 32660:
+			return utm(int(id-32600), false, wgs84InvF), nil
+		case id >= 32701 && id <= 32760:
+			return utm(int(id-32700), true, wgs84InvF), nil
+		case id >= 25828 && id <= 25838:
+			return utm(int(id-25800), false, grs80InvF), nil
+		}
+	}
+	if strings.EqualFold(organization, "OGC") && id == 84 {
+		return nil, nil
+	}
+	if isGreenwich(definition) {
+		if isGeographic(definition) {
+			return nil, nil
+		}
+		if p, ok := parseProjection(definition); ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s:%d", ErrUnsupportedSrs, organization, id)
+}
+
+var (
+	wktGeographic = regexp.MustCompile(`(?i)^\s*GEOG(?:CS|CRS)\s*\[`)
+	wktDegree     = regexp.MustCompile(`(?i)UNIT\[\s*"degree`)
+	wktParameter  = regexp.MustCompile(`(?i)PARAMETER\[\s*"([^"]+)"\s*,\s*([-+0-9.eE]+)`)
+	wktSpheroid   = regexp.MustCompile(`(?i)(?:SPHEROID|ELLIPSOID)\[\s*"[^"]*"\s*,\s*([0-9.eE+]+)\s*,\s*([0-9.eE+]+)`)
+	wktPrimem     = regexp.MustCompile(`(?i)PRIMEM\[\s*"[^"]*"\s*,\s*([-+0-9.eE]+)`)
+	wktMethod     = regexp.MustCompile(`(?i)\b(?:PROJECTION|METHOD)\[\s*"([^"]+)"`)
+	wktUnit       = regexp.MustCompile(`(?i)\b(?:LENGTH)?UNIT\[\s*"[^"]*"\s*,\s*([0-9.eE+]+)`)
+)
+
+// isGreenwich reports whether the WKT definition measures longitudes from
+// the Greenwich meridian, which is assumed if it has no prime meridian
+func isGreenwich(definition string) bool {
+	for _, m := range wktPrimem.FindAllStringSubmatch(definition, -1) {
+		if v, err := strconv.ParseFloat(m[1], 64); err != nil || v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isGeographic reports whether the WKT definition is of a geographic
+// coordinate reference system in degrees, e.g. ETRS89 or NAD83, whose
+// datum is treated as equivalent to WGS 84
+func isGeographic(definition string) bool {
+	return wktGeographic.MatchString(definition) && wktDegree.MatchString(definition)
+}
+
+// parseProjection returns the projection of a WKT definition using the
+// transverse Mercator or Web Mercator projection in meters
+func parseProjection(definition string) (projection, bool) {
+	// the last unit is the linear unit of the projected system, the
+	// angular units of its base geographic system come before it
+	if ms := wktUnit.FindAllStringSubmatch(definition, -1); len(ms) > 0 {
+		if v, err := strconv.ParseFloat(ms[len(ms)-1][1], 64); err != nil || v != 1 {
+			return nil, false
+		}
+	}
+	m := wktMethod.FindStringSubmatch(definition)
+	if m == nil {
+		return nil, false
+	}
+	switch strings.ToLower(strings.ReplaceAll(m[1], "_", " ")) {
+	case "mercator auxiliary sphere", "popular visualisation pseudo mercator":
+		return webMercator{}, true
+	case "transverse mercator":
+	default:
+		return nil, false
+	}
+
+	tm := transverseMercator{
+		a:  wgs84A,
+		f:  1 / wgs84InvF,
+		k0: 1,
+	}
+	if m := wktSpheroid.FindStringSubmatch(definition); m != nil {
+		a, err1 := strconv.ParseFloat(m[1], 64)
+		invf, err2 := strconv.ParseFloat(m[2], 64)
+		if err1 != nil || err2 != nil || a <= 0 || invf <= 0 {
+			return nil, false
+		}
+		tm.a, tm.f = a, 1/invf
+	}
+	for _, m := range wktParameter.FindAllStringSubmatch(definition, -1) {
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return nil, false
+		}
+		switch strings.ToLower(strings.ReplaceAll(m[1], "_", " ")) {
+		case "central meridian", "longitude of natural origin":
+			tm.lng0 = v
+		case "latitude of origin", "latitude of natural origin":
+			tm.lat0 = v
+		case "scale factor", "scale factor at natural origin":
+			tm.k0 = v
+		case "false easting":
+			tm.x0 = v
+		case "false northing":
+			tm.y0 = v
+		}
+	}
+	return newTransverseMercator(tm), true
+}
+
+// webMercator is the spherical Web Mercator projection, EPSG:3857
+type webMercator struct{}
+
+func (webMercator) forward(lng, lat float64) (x, y float64) {
+	// clamp to the latitude where the projection is square
+	lat = math.Max(-85.05112878, math.Min(85.05112878, lat))
+	x = wgs84A * lng * math.Pi / 180
+	y = wgs84A * math.Log(math.Tan(math.Pi/4+lat*math.Pi/360))
+	return x, y
+}
+
+func (webMercator) inverse(x, y float64) (lng, lat float64) {
+	lng = x / wgs84A * 180 / math.Pi
+	lat = (2*math.Atan(math.Exp(y/wgs84A)) - math.Pi/2) * 180 / math.Pi
+	return lng, lat
+}
+
+// transverseMercator is the ellipsoidal transverse Mercator projection
+// using the Krüger series, accurate to well below a millimeter within the
+// width of a UTM zone.
+type transverseMercator struct {
+	a, f       float64 // ellipsoid semi-major axis and flattening
+	lng0, lat0 float64 // natural origin in degrees
+	k0         float64 // scale factor on the central meridian
+	x0, y0     float64 // false easting and northing
+
+	e     float64
+	ak0   float64
+	xi0   float64
+	alpha [4]float64
+	beta  [4]float64
+	delta [4]float64
+}
+
+// utm returns the Universal Transverse Mercator projection of the zone
+func utm(zone int, south bool, invf float64) transverseMercator {
+	tm := transverseMercator{
+		a:    wgs84A,
+		f:    1 / invf,
+		lng0: float64(zone*6 - 183),
+		k0:   0.9996,
+		x0:   500000,
+	}
+	if south {
+		tm.y0 = 10000000
+	}
+	return newTransverseMercator(tm)
+}
+
+// newTransverseMercator computes the series coefficients of tm
+func newTransverseMercator(tm transverseMercator) transverseMercator {
+	n := tm.f / (2 - tm.f)
+	n2, n3, n4 := n*n, n*n*n, n*n*n*n
+	tm.e = math.Sqrt(tm.f * (2 - tm.f))
+	tm.ak0 = tm.k0 * tm.a / (1 + n) * (1 + n2/4 + n4/64)
+	tm.alpha = [4]float64{
+		n/2 - 2*n2/3 + 5*n3/16 + 41*n4/180,
+		13*n2/48 - 3*n3/5 + 557*n4/1440,
+		61*n3/240 - 103*n4/140,
+		49561 * n4 / 161280,
+	}
+	tm.beta = [4]float64{
+		n/2 - 2*n2/3 + 37*n3/96 - n4/360,
+		n2/48 + n3/15 - 437*n4/1440,
+		17*n3/480 - 37*n4/840,
+		4397 * n4 / 161280,
+	}
+	tm.delta = [4]float64{
+		2*n - 2*n2/3 - 2*n3 + 116*n4/45,
+		7*n2/3 - 8*n3/5 - 227*n4/45,
+		56*n3/15 - 136*n4/35,
+		4279 * n4 / 630,
+	}
+	tm.xi0, _ = tm.conformal(tm.lat0*math.Pi/180, 0)
+	return tm
+}
+
+// conformal returns the normalized northing xi and easting eta of the
+// latitude and longitude relative to the central meridian in radians
+func (tm transverseMercator) conformal(lat, lng float64) (xi, eta float64) {
+	sin := math.Sin(lat)
+	t := math.Sinh(math.Atanh(sin) - tm.e*math.Atanh(tm.e*sin))
+	xip := math.Atan2(t, math.Cos(lng))
+	etap := math.Atanh(math.Sin(lng) / math.Sqrt(1+t*t))
+	xi, eta = xip, etap
+	for j, a := range tm.alpha {
+		k := float64(2 * (j + 1))
+		xi += a * math.Sin(k*xip) * math.Cosh(k*etap)
+		eta += a * math.Cos(k*xip) * math.Sinh(k*etap)
+	}
+	return xi, eta
+}
+
+func (tm transverseMercator) forward(lng, lat float64) (x, y float64) {
+	dlng := math.Remainder(lng-tm.lng0, 360)
+	xi, eta := tm.conformal(lat*math.Pi/180, dlng*math.Pi/180)
+	x = tm.x0 + tm.ak0*eta
+	y = tm.y0 + tm.ak0*(xi-tm.xi0)
+	return x, y
+}
+
+func (tm transverseMercator) inverse(x, y float64) (lng, lat float64) {
+	xi := (y-tm.y0)/tm.ak0 + tm.xi0
+	eta := (x - tm.x0) / tm.ak0
+	xip, etap := xi, eta
+	for j, b := range tm.beta {
+		k := float64(2 * (j + 1))
+		xip -= b * math.Sin(k*xi) * math.Cosh(k*eta)
+		etap -= b * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+	chi := math.Asin(math.Sin(xip) / math.Cosh(etap))
+	phi := chi
+	for j, d := range tm.delta {
+		phi += d * math.Sin(float64(2*(j+1))*chi)
+	}
+	lng = tm.lng0 + math.Atan2(math.Sinh(etap), math.Cos(xip))*180/math.Pi
+	lat = phi * 180 / math.Pi
+	return lng, lat
+}
+
+// point returns the coordinates of l in the coordinate reference system
+// of the table
+func (g *GeoPackage) point(l s2.LatLng) geom.XY {
+	if g.proj == nil {
+		return geom.XY{X: l.Lng.Degrees(), Y: l.Lat.Degrees()}
+	}
+	x, y := g.proj.forward(l.Lng.Degrees(), l.Lat.Degrees())
+	return geom.XY{X: x, Y: y}
+}
+
+// Unproject returns gm, as stored in the table, transformed to longitude
+// and latitude degrees. It returns gm unchanged if the table uses
+// longitude/latitude coordinates.
+func (g *GeoPackage) Unproject(gm geom.Geometry) (geom.Geometry, error) {
+	if g.proj == nil {
+		return gm, nil
+	}
+	return gm.TransformXY(func(xy geom.XY) geom.XY {
+		lng, lat := g.proj.inverse(xy.X, xy.Y)
+		return geom.XY{X: lng, Y: lat}
+	}, skipValidationOpts...)
+}
+
+// bounds is an axis-aligned bounding box
+type bounds struct {
+	minX, maxX, minY, maxY float64
+}
+
+// expand returns b expanded to include x, y
+func (b bounds) expand(x, y float64) bounds {
+	return bounds{
+		minX: math.Min(b.minX, x),
+		maxX: math.Max(b.maxX, x),
+		minY: math.Min(b.minY, y),
+		maxY: math.Max(b.maxY, y),
+	}
+}
+
+// searchBounds returns the bounding boxes in the coordinate reference
+// system of the table covering all points within dist meters of l
+func (g *GeoPackage) searchBounds(l s2.LatLng, dist float64) []bounds {
+	return g.rectBounds(searchRects(l, dist))
+}
+
+// rectBounds returns the bounding boxes in the coordinate reference
+// system of the table covering the rectangles, which must not cross the
+// antimeridian
+func (g *GeoPackage) rectBounds(rects []s2.Rect) []bounds {
+	bs := make([]bounds, 0, len(rects))
+	for _, r := range rects {
+		lo, hi := r.Lo(), r.Hi()
+		if g.proj == nil {
+			bs = append(bs, bounds{
+				minX: lo.Lng.Degrees(),
+				maxX: hi.Lng.Degrees(),
+				minY: lo.Lat.Degrees(),
+				maxY: hi.Lat.Degrees(),
+			})
+			continue
+		}
+		// The projected rectangle is curved, so sample its edges and add
+		// a margin for the bulge between the samples
+		const samples = 16
+		b := bounds{
+			minX: math.Inf(1), maxX: math.Inf(-1),
+			minY: math.Inf(1), maxY: math.Inf(-1),
+		}
+		for i := 0; i <= samples; i++ {
+			f := float64(i) / samples
+			lng := lo.Lng.Degrees() + f*(hi.Lng.Degrees()-lo.Lng.Degrees())
+			lat := lo.Lat.Degrees() + f*(hi.Lat.Degrees()-lo.Lat.Degrees())
+			for _, ll := range [][2]float64{
+				{lng, lo.Lat.Degrees()},
+				{lng, hi.Lat.Degrees()},
+				{lo.Lng.Degrees(), lat},
+				{hi.Lng.Degrees(), lat},
+			} {
+				x, y := g.proj.forward(ll[0], ll[1])
+				b = b.expand(x, y)
+			}
+		}
+		mx, my := (b.maxX-b.minX)/samples, (b.maxY-b.minY)/samples
+		b.minX, b.maxX = b.minX-mx, b.maxX+mx
+		b.minY, b.maxY = b.minY-my, b.maxY+my
+		bs = append(bs, b)
+	}
+	return bs
+}
@@ -0,0 +1,289 @@
+package gpkg
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"github.com/smilyorg/tinygpkg/writer"
+)
+
+// etrs89 is the WKT definition of EPSG:4258, the geographic ETRS89
+const etrs89 = `GEOGCS["ETRS89",
+	DATUM["European_Terrestrial_Reference_System_1989",
+		SPHEROID["GRS 1980",6378137,298.257222101]],
+	PRIMEM["Greenwich",0],
+	UNIT["degree",0.0174532925199433]]`
+
+// d96tm is the WKT definition of EPSG:3794, Slovenia 1996 / Slovene
+// National Grid, a transverse Mercator projection on GRS 1980
+const d96tm = `PROJCS["Slovenia 1996 / Slovene National Grid",
+	GEOGCS["Slovenia 1996",
+		DATUM["Slovenia_Geodetic_Datum_1996",
+			SPHEROID["GRS 1980",6378137,298.257222101]],
+		PRIMEM["Greenwich",0],
+		UNIT["degree",0.0174532925199433]],
+	PROJECTION["Transverse_Mercator"],
+	PARAMETER["latitude_of_origin",0],
+	PARAMETER["central_meridian",15],
+	PARAMETER["scale_factor",0.9999],
+	PARAMETER["false_easting",500000],
+	PARAMETER["false_northing",-5000000],
+	UNIT["metre",1]]`
+
+func TestProjection(t *testing.T) {
+	tests := []struct {
+		name         string
+		organization string
+		id           int64
+		definition   string
+		lng, lat     float64
+		x, y         float64
+	}{
+		{"utm 33n", "EPSG", 32633, "", 15, 45, 500000, 4982950.40},
+		{"utm 33n off meridian", "EPSG", 32633, "", 16, 46, 577432.18, 5094533.59},
+		{"utm 33n equator", "EPSG", 32633, "", 15, 0, 500000, 0},
+		{"utm 19s", "EPSG", 32719, "", -69, -33, 500000, 6348713.06},
+		{"etrs89 utm 32n", "epsg", 25832, "", 9, 0, 500000, 0},
+		{"web mercator", "EPSG", 3857, "", 15, 45, 1669792.36, 5621521.49},
+		{"web mercator origin", "EPSG", 3857, "", 0, 0, 0, 0},
+		{"wkt transverse mercator", "EPSG", 3794, d96tm, 15, 46, 500000, 95576.32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newProjection(1, tt.organization, tt.id, tt.definition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x, y := p.forward(tt.lng, tt.lat)
+			if math.Abs(x-tt.x) > 0.01 || math.Abs(y-tt.y) > 0.01 {
+				t.Errorf("forward() = %.2f, %.2f, want %.2f, %.2f", x, y, tt.x, tt.y)
+			}
+			lng, lat := p.inverse(x, y)
+			if math.Abs(lng-tt.lng) > 1e-9 || math.Abs(lat-tt.lat) > 1e-9 {
+				t.Errorf("inverse() = %f, %f, want %f, %f", lng, lat, tt.lng, tt.lat)
+			}
+		})
+	}
+}
+
+func TestProjectionGeographic(t *testing.T) {
+	tests := []struct {
+		srsId        int32
+		organization string
+		id           int64
+		definition   string
+	}{
+		{4326, "EPSG", 4326, "undefined"},
+		{0, "NONE", 0, "undefined"},
+		{-1, "NONE", -1, "undefined"},
+		{84, "OGC", 84, "undefined"},
+		{4258, "EPSG", 4258, etrs89},
+		{4269, "EPSG", 4269, `GEOGCRS["NAD83",
+			DATUM["North American Datum 1983",
+				ELLIPSOID["GRS 1980",6378137,298.257222101,LENGTHUNIT["metre",1]]],
+			PRIMEM["Greenwich",0,ANGLEUNIT["degree",0.0174532925199433]],
+			CS[ellipsoidal,2],
+				AXIS["geodetic latitude (Lat)",north,ORDER[1],ANGLEUNIT["degree",0.0174532925199433]],
+				AXIS["geodetic longitude (Lon)",east,ORDER[2],ANGLEUNIT["degree",0.0174532925199433]],
+			ID["EPSG",4269]]`},
+	}
+	for _, tt := range tests {
+		p, err := newProjection(tt.srsId, tt.organization, tt.id, tt.definition)
+		if err != nil || p != nil {
+			t.Errorf("%s:%d got %v, %v, want nil projection", tt.organization, tt.id, p, err)
+		}
+	}
+}
+
+func TestProjectionUnsupported(t *testing.T) {
+	_, err := newProjection(27700, "EPSG", 27700, "undefined")
+	if !errors.Is(err, ErrUnsupportedSrs) {
+		t.Errorf("got %v, want ErrUnsupportedSrs", err)
+	}
+	// Geographic in grads rather than degrees
+	_, err = newProjection(4807, "EPSG", 4807, `GEOGCS["NTF (Paris)",
+		DATUM["Nouvelle_Triangulation_Francaise_Paris",
+			SPHEROID["Clarke 1880 (IGN)",6378249.2,293.4660212936269]],
+		PRIMEM["Paris",2.5969213],
+		UNIT["grad",0.01570796326794897]]`)
+	if !errors.Is(err, ErrUnsupportedSrs) {
+		t.Errorf("got %v, want ErrUnsupportedSrs", err)
+	}
+
+	tests := []struct {
+		name       string
+		definition string
+	}{
+		{"us survey feet", `PROJCS["NAD83 / Florida East (ftUS)",
+			GEOGCS["NAD83",
+				DATUM["North_American_Datum_1983",
+					SPHEROID["GRS 1980",6378137,298.257222101]],
+				PRIMEM["Greenwich",0],
+				UNIT["degree",0.0174532925199433]],
+			PROJECTION["Transverse_Mercator"],
+			PARAMETER["latitude_of_origin",24.33333333333333],
+			PARAMETER["central_meridian",-81],
+			PARAMETER["scale_factor",0.999941177],
+			PARAMETER["false_easting",656166.667],
+			PARAMETER["false_northing",0],
+			UNIT["US survey foot",0.3048006096012192]]`},
+		{"south orientated", `PROJCS["Hartebeesthoek94 / Lo29",
+			GEOGCS["Hartebeesthoek94",
+				DATUM["Hartebeesthoek94",
+					SPHEROID["WGS 84",6378137,298.257223563]],
+				PRIMEM["Greenwich",0],
+				UNIT["degree",0.0174532925199433]],
+			PROJECTION["Transverse_Mercator_South_Orientated"],
+			PARAMETER["latitude_of_origin",0],
+			PARAMETER["central_meridian",29],
+			PARAMETER["scale_factor",1],
+			PARAMETER["false_easting",0],
+			PARAMETER["false_northing",0],
+			UNIT["metre",1]]`},
+		{"paris meridian", `PROJCS["NTF (Paris) / UTM-like",
+			GEOGCS["NTF (Paris)",
+				DATUM["Nouvelle_Triangulation_Francaise_Paris",
+					SPHEROID["Clarke 1880 (IGN)",6378249.2,293.4660212936269]],
+				PRIMEM["Paris",2.33722917],
+				UNIT["degree",0.0174532925199433]],
+			PROJECTION["Transverse_Mercator"],
+			PARAMETER["central_meridian",0],
+			PARAMETER["scale_factor",0.9996],
+			PARAMETER["false_easting",500000],
+			UNIT["metre",1]]`},
+		{"paris geographic", `GEOGCS["NTF (Paris)",
+			DATUM["Nouvelle_Triangulation_Francaise_Paris",
+				SPHEROID["Clarke 1880 (IGN)",6378249.2,293.4660212936269]],
+			PRIMEM["Paris",2.33722917],
+			UNIT["degree",0.0174532925199433]]`},
+		{"projection in parameter name", `PROJCS["Lambert",
+			GEOGCS["WGS 84",
+				DATUM["WGS_1984",
+					SPHEROID["WGS 84",6378137,298.257223563]],
+				PRIMEM["Greenwich",0],
+				UNIT["degree",0.0174532925199433]],
+			PROJECTION["Lambert_Conformal_Conic_2SP"],
+			PARAMETER["standard_parallel_1",45],
+			AUTHORITY["transverse_mercator","1"],
+			UNIT["metre",1]]`},
+	}
+	for _, tt := range tests {
+		_, err := newProjection(1, "EPSG", 1, tt.definition)
+		if !errors.Is(err, ErrUnsupportedSrs) {
+			t.Errorf("%s: got %v, want ErrUnsupportedSrs", tt.name, err)
+		}
+	}
+}
+
+func TestWebMercatorClamp(t *testing.T) {
+	// the projection is square at the clamped latitude
+	_, y := webMercator{}.forward(0, 90)
+	if want := wgs84A * math.Pi; math.Abs(y-want) > 0.01 {
+		t.Errorf("got y %.2f at the pole, want %.2f", y, want)
+	}
+}
+
+func TestOpenGeographicSrs(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{
+		Srs: writer.SpatialRefSys{
+			Name:           "ETRS89",
+			Id:             4258,
+			Organization:   "EPSG",
+			OrganizationId: 4258,
+			Definition:     etrs89,
+		},
+	})
+	g, err := Open(path, "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	cols, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols[0] != "east" {
+		t.Errorf("got %q, want %q", cols[0], "east")
+	}
+}
+
+func TestOpenUnsupportedSrs(t *testing.T) {
+	path := createTestGeoPackageSchema(t, testSchema{
+		fidCol:  "fid",
+		geomCol: "geom",
+		srsId:   27700,
+	}, nil)
+	_, err := Open(path, "", []string{"name"})
+	if !errors.Is(err, ErrUnsupportedSrs) {
+		t.Errorf("got %v, want ErrUnsupportedSrs", err)
+	}
+}
+
+func TestReverseGeocodeProjected(t *testing.T) {
+	tests := []struct {
+		name       string
+		srsId      int32
+		definition string
+		wkt        string
+	}{
+		{
+			// 20 km square centered on 45°N 15°E
+			name:  "utm",
+			srsId: 32633,
+			wkt:   "POLYGON((490000 4972950,510000 4972950,510000 4992950,490000 4992950,490000 4972950))",
+		},
+		{
+			name:  "web mercator",
+			srsId: 3857,
+			wkt:   "POLYGON((1655650 5607380,1683935 5607380,1683935 5635665,1655650 5635665,1655650 5607380))",
+		},
+		{
+			name:       "wkt",
+			srsId:      3794,
+			definition: d96tm,
+			wkt:        "POLYGON((490000 -25554,510000 -25554,510000 -5554,490000 -5554,490000 -25554))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := createTestGeoPackageSchema(t, testSchema{
+				fidCol:        "fid",
+				geomCol:       "geom",
+				srsId:         tt.srsId,
+				srsDefinition: tt.definition,
+			}, []testFeature{{wkt: tt.wkt, name: "square"}})
+			g, err := Open(path, "", []string{"name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+			g.Strict = true
+
+			got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(45, 15))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0] != "square" {
+				t.Errorf("got %q, want %q", got, "square")
+			}
+
+			// about 15.7 km east of the center
+			l := s2.LatLngFromDegrees(45, 15.2)
+			if _, err := g.ReverseGeocode(context.Background(), l); err != ErrNotFound {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+			g.MaxDistance = 10_000
+			f, err := g.ReverseGeocodeFeature(context.Background(), l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Distance < 4_000 || f.Distance > 7_000 {
+				t.Errorf("got distance %f, want about 5.7 km", f.Distance)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package gpkg
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+)
+
+var ErrUnknownSrs = errors.New("unknown srs")
+
+// FeatureError is returned for a feature with an invalid geometry blob,
+// e.g. when decoding fails or Strict validation rejects it.
+type FeatureError struct {
+	Id  FeatureId
+	Err error
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("feature %d: %v", e.Id, e.Err)
+}
+
+func (e *FeatureError) Unwrap() error {
+	return e.Err
+}
+
+// header parses the header of the geometry blob b of the feature fid and
+// returns it with the offset of the payload. If Strict is set, the header
+// is validated and its SRS id must be the one of the geometry column.
+func (g *GeoPackage) header(fid FeatureId, b []byte) (binary.Header, int, error) {
+	h, n, err := binary.ParseHeader(b)
+	if err == nil && g.Strict {
+		err = validateHeader(&h, g.srsId, g.srsIds)
+	}
+	if err != nil {
+		return h, 0, &FeatureError{Id: fid, Err: err}
+	}
+	return h, n, nil
+}
+
+// validateHeader validates the header h of a geometry blob of a geometry
+// column using the SRS srsId, with srsIds the SRS ids defined in the
+// GeoPackage
+func validateHeader(h *binary.Header, srsId int32, srsIds map[int32]bool) error {
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	if !srsIds[h.SrsId] {
+		return fmt.Errorf("%w: %d", ErrUnknownSrs, h.SrsId)
+	}
+	if h.SrsId != srsId {
+		return fmt.Errorf("%w: %d, the geometry column uses %d", ErrUnsupportedSrs, h.SrsId, srsId)
+	}
+	return nil
+}
+
+// ValidateGeometry decodes the geometry blob b of a geometry column using
+// the SRS srsId and validates it like a GeoPackage with Strict and Validate
+// set, with srsIds the ids of the spatial reference systems defined in
+// "gpkg_spatial_ref_sys". This is useful to check the whole table of a
+// GeoPackage before serving it.
+func ValidateGeometry(b []byte, srsId int32, srsIds map[int32]bool) (geom.Geometry, error) {
+	h, n, err := binary.ParseHeader(b)
+	if err != nil {
+		return geom.Geometry{}, err
+	}
+	if err := validateHeader(&h, srsId, srsIds); err != nil {
+		return geom.Geometry{}, err
+	}
+	g, err := binary.UnmarshalPayload(&h, b[n:])
+	if err != nil {
+		return g, err
+	}
+	if err := h.ValidateGeometry(g); err != nil {
+		return g, err
+	}
+	return g, h.ValidateEnvelope(g, b[n:])
+}
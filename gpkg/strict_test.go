@@ -0,0 +1,147 @@
+package gpkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+)
+
+func TestStrict(t *testing.T) {
+	square := "POLYGON((0 0,10 0,10 10,0 10,0 0))"
+	tests := []struct {
+		name    string
+		corrupt func(b []byte)
+		wantErr error
+	}{
+		{
+			name:    "valid",
+			corrupt: func(b []byte) {},
+		},
+		{
+			name:    "version",
+			corrupt: func(b []byte) { b[2] = 1 },
+			wantErr: binary.ErrInvalidVersion,
+		},
+		{
+			name:    "envelope code",
+			corrupt: func(b []byte) { b[3] |= 5 << 1 },
+			wantErr: binary.ErrInvalidEnvelope,
+		},
+		{
+			name:    "srs",
+			corrupt: func(b []byte) { b[4], b[5] = 0x00, 0x00 },
+			wantErr: ErrUnknownSrs,
+		},
+		{
+			name:    "empty flag",
+			corrupt: func(b []byte) { b[3] |= 0b0001_0000 },
+			wantErr: binary.ErrInconsistentEmpty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features := []testFeature{
+				{wkt: square, name: "valid"},
+				{wkt: square, name: "corrupt", corrupt: tt.corrupt},
+			}
+			g, err := Open(createTestGeoPackage(t, features), "", []string{"name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer g.Close()
+			l := s2.LatLngFromDegrees(5, 5)
+
+			// lenient by default
+			if _, err := g.ReverseGeocodeAll(context.Background(), l); err != nil {
+				t.Fatalf("got %v without Strict, want nil", err)
+			}
+
+			g.Strict = true
+			_, err = g.ReverseGeocodeAll(context.Background(), l)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			var ferr *FeatureError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("got %T, want *FeatureError", err)
+			}
+			if ferr.Id != 2 {
+				t.Errorf("got feature id %d, want 2", ferr.Id)
+			}
+		})
+	}
+}
+
+func TestValidateGeometry(t *testing.T) {
+	square, err := geom.UnmarshalWKT("POLYGON((0 0,10 0,10 10,0 10,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srsIds := map[int32]bool{0: true, 4326: true}
+	marshal := func(srsId int32, env *binary.Envelope) []byte {
+		h := binary.NewHeader(srsId, square)
+		if env != nil {
+			h.Envelope = *env
+		}
+		var buf bytes.Buffer
+		if err := h.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(square.AsBinary())
+		return buf.Bytes()
+	}
+	tests := []struct {
+		name    string
+		b       []byte
+		wantErr error
+	}{
+		{"valid", marshal(4326, nil), nil},
+		{"truncated", marshal(4326, nil)[:6], io.ErrUnexpectedEOF},
+		{"unknown srs", marshal(3857, nil), ErrUnknownSrs},
+		{"other srs", marshal(0, nil), ErrUnsupportedSrs},
+		{"envelope", marshal(4326, &binary.Envelope{MinX: 0, MaxX: 5, MinY: 0, MaxY: 10}), binary.ErrOutsideEnvelope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ValidateGeometry(tt.b, 4326, srsIds)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !geom.ExactEquals(g, square) {
+				t.Errorf("got %s, want %s", g.AsText(), square.AsText())
+			}
+		})
+	}
+}
+
+func TestStrictTWKBEnvelope(t *testing.T) {
+	// The envelope is of the exact coordinates, which TWKB rounds
+	features := []testFeature{{
+		wkt:      "POLYGON((1.23456 1.23456,3.45678 1.23456,3.45678 3.45678,1.23456 1.23456))",
+		twkb:     true,
+		envelope: &binary.Envelope{MinX: 1.23456, MaxX: 3.45678, MinY: 1.23456, MaxY: 3.45678},
+		name:     "triangle",
+	}}
+	g, err := Open(createTestGeoPackage(t, features), "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Strict = true
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(2, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0] != "triangle" {
+		t.Errorf("got %q, want %q", got[0], "triangle")
+	}
+}
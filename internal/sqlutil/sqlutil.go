@@ -0,0 +1,36 @@
+// Package sqlutil contains the SQL helpers shared by the packages reading
+// and writing GeoPackages.
+package sqlutil
+
+import (
+	"strings"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// QuoteIdent quotes an SQL identifier, e.g. a table or column name
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// PrimaryKey returns the INTEGER primary key column of the table, which
+// is an alias of its rowid, or "rowid" if it has none
+func PrimaryKey(conn *sqlite.Conn, table string) (string, error) {
+	pk := "rowid"
+	err := sqlitex.Execute(conn, `
+		SELECT name
+		FROM pragma_table_info(?)
+		WHERE pk = 1 AND type = 'INTEGER' COLLATE NOCASE AND (
+			SELECT count(*)
+			FROM pragma_table_info(?)
+			WHERE pk > 0
+		) = 1`, &sqlitex.ExecOptions{
+		Args: []any{table, table},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			pk = stmt.ColumnText(0)
+			return nil
+		},
+	})
+	return pk, err
+}
@@ -0,0 +1,55 @@
+package sqlutil
+
+import (
+	"testing"
+
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"places", `"places"`},
+		{`we"ird`, `"we""ird"`},
+	}
+	for _, tt := range tests {
+		if got := QuoteIdent(tt.name); got != tt.want {
+			t.Errorf("QuoteIdent(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	err = sqlitex.ExecuteScript(conn, `
+		CREATE TABLE integer_pk (id integer PRIMARY KEY, name TEXT);
+		CREATE TABLE text_pk (code TEXT PRIMARY KEY, name TEXT);
+		CREATE TABLE composite_pk (a INTEGER, b INTEGER, PRIMARY KEY (a, b));
+		CREATE TABLE no_pk (name TEXT);
+	`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"integer_pk":   "id",
+		"text_pk":      "rowid",
+		"composite_pk": "rowid",
+		"no_pk":        "rowid",
+	}
+	for table, want := range tests {
+		got, err := PrimaryKey(conn, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("PrimaryKey(%s) = %s, want %s", table, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Package testgpkg creates the small GeoPackages shared by the tests of
+// the other packages.
+package testgpkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/writer"
+)
+
+// Feature is a feature of the "places" test table
+type Feature struct {
+	WKT  string
+	Name string
+	Rank int
+}
+
+// Features are the features of the "places" test table in fid order,
+// small squares with "outer" containing "inner", and a last feature with
+// an empty geometry that is only written with Options.Empty.
+var Features = []Feature{
+	{WKT: "POLYGON((0 0,10 0,10 10,0 10,0 0))", Name: "outer", Rank: 1},
+	{WKT: "POLYGON((2 2,4 2,4 4,2 4,2 2))", Name: "inner", Rank: 2},
+	{WKT: "POLYGON((20 0,30 0,30 10,20 10,20 0))", Name: "east", Rank: 3},
+	{WKT: "POLYGON EMPTY", Name: "empty", Rank: 4},
+}
+
+// Table is the definition of the "places" test table
+var Table = writer.Table{
+	Name: "places",
+	Columns: []writer.Column{
+		{Name: "name", Type: writer.Text},
+		{Name: "rank", Type: writer.Integer},
+	},
+}
+
+// Options configures Create
+type Options struct {
+	// Encoding and Precision configure the geometries, see writer.Table
+	Encoding  writer.Encoding
+	Precision int
+	// Srs is the spatial reference system of the table, see writer.Table
+	Srs writer.SpatialRefSys
+	// Empty writes the feature with an empty geometry
+	Empty bool
+}
+
+// Create writes a GeoPackage with the "places" table and its Features to
+// a temporary directory of t and returns its path
+func Create(t testing.TB, opts Options) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	w, err := writer.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := Table
+	table.Encoding = opts.Encoding
+	table.Precision = opts.Precision
+	table.Srs = opts.Srs
+	ft, err := w.CreateTable(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range Features {
+		g, err := geom.UnmarshalWKT(f.WKT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.IsEmpty() && !opts.Empty {
+			continue
+		}
+		if _, err := ft.Insert(g, f.Name, f.Rank); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
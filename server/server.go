@@ -0,0 +1,314 @@
+// Package server serves reverse geocoding queries of GeoPackages over
+// HTTP as JSON.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+
+	"github.com/golang/geo/s2"
+	"github.com/smilyorg/tinygpkg/gpkg"
+)
+
+// DefaultMaxBatch is the default maximum number of points of a batch
+// request
+const DefaultMaxBatch = 1000
+
+// Dataset maps a name to the table and columns of a GeoPackage, with the
+// same parameters as gpkg.Open
+type Dataset struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	// MaxDistance sets gpkg.GeoPackage.MaxDistance
+	MaxDistance float64 `json:"max_distance"`
+}
+
+// Server is an http.Handler serving reverse geocoding queries of its
+// datasets:
+//
+//	GET /reverse?lat=48.8566&lon=2.3522
+//	POST /reverse {"points": [{"lat": 48.8566, "lon": 2.3522}, ...]}
+//
+// Both accept a "dataset" parameter selecting the dataset by name, the
+// first one by default, and a "geometry" parameter to include the
+// geometry of the features as GeoJSON. A GET request responds with a
+// Feature, or 404 Not Found if there is none. A POST request responds
+// with a BatchResponse with one result per point.
+//
+// The request context is passed to the queries, so they are canceled if
+// the client goes away.
+type Server struct {
+	// MaxBatch is the maximum number of points of a batch request,
+	// DefaultMaxBatch if zero
+	MaxBatch int
+
+	datasets map[string]*gpkg.GeoPackage
+	fallback string
+	mux      *http.ServeMux
+}
+
+// Feature is a feature found for a point
+type Feature struct {
+	Id gpkg.FeatureId `json:"fid"`
+	// Columns are the values of the columns of the dataset by name
+	Columns map[string]any `json:"columns"`
+	// Distance is the distance in meters to the feature if it is the
+	// nearest one within the MaxDistance of the dataset
+	Distance float64 `json:"distance,omitempty"`
+	// Geometry is the GeoJSON geometry in longitude/latitude degrees, if
+	// requested
+	Geometry json.RawMessage `json:"geometry,omitempty"`
+}
+
+// Point is a point of a BatchRequest
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// BatchRequest is the body of a POST request
+type BatchRequest struct {
+	Points []Point `json:"points"`
+}
+
+// BatchResult is the result of a point of a batch, either a Feature or an
+// Error, e.g. "not found"
+type BatchResult struct {
+	*Feature
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse is the response to a POST request, with the results in
+// the order of the points of the request
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New opens the GeoPackages of the datasets and returns a Server serving
+// them. The names of the datasets must be unique, and the first one is
+// used by default.
+func New(datasets []Dataset) (*Server, error) {
+	if len(datasets) == 0 {
+		return nil, errors.New("no datasets specified")
+	}
+	s := &Server{
+		datasets: make(map[string]*gpkg.GeoPackage),
+		fallback: datasets[0].Name,
+		mux:      http.NewServeMux(),
+	}
+	for _, d := range datasets {
+		if _, ok := s.datasets[d.Name]; ok {
+			s.Close()
+			return nil, fmt.Errorf("duplicate dataset %q", d.Name)
+		}
+		g, err := gpkg.Open(d.Path, d.Table, d.Columns)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("error opening dataset %q: %w", d.Name, err)
+		}
+		g.MaxDistance = d.MaxDistance
+		s.datasets[d.Name] = g
+	}
+	s.mux.HandleFunc("/reverse", s.reverse)
+	return s, nil
+}
+
+// Dataset returns the GeoPackage of the named dataset, e.g. to set its
+// Order or Filters before serving, or nil if there is none
+func (s *Server) Dataset(name string) *gpkg.GeoPackage {
+	return s.datasets[name]
+}
+
+func (s *Server) Close() error {
+	var errs []error
+	for _, g := range s.datasets {
+		errs = append(errs, g.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) reverse(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("dataset")
+	if name == "" {
+		name = s.fallback
+	}
+	g := s.datasets[name]
+	if g == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown dataset %q", name))
+		return
+	}
+	withGeometry := false
+	if v := q.Get("geometry"); v != "" {
+		var err error
+		withGeometry, err = strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid geometry parameter")
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.reverseOne(w, r, g, withGeometry)
+	case http.MethodPost:
+		s.reverseBatch(w, r, g, withGeometry)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) reverseOne(w http.ResponseWriter, r *http.Request, g *gpkg.GeoPackage, withGeometry bool) {
+	q := r.URL.Query()
+	lat, err1 := strconv.ParseFloat(q.Get("lat"), 64)
+	lon, err2 := strconv.ParseFloat(q.Get("lon"), 64)
+	if err1 != nil || err2 != nil {
+		writeError(w, http.StatusBadRequest, "invalid or missing lat and lon parameters")
+		return
+	}
+	p := Point{Lat: lat, Lon: lon}
+	if err := p.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f, err := g.ReverseGeocodeFeature(r.Context(), p.latLng())
+	if errors.Is(err, gpkg.ErrNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeQueryError(w, r, err)
+		return
+	}
+	feature, err := newFeature(g, f, withGeometry)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, feature)
+}
+
+func (s *Server) reverseBatch(w http.ResponseWriter, r *http.Request, g *gpkg.GeoPackage, withGeometry bool) {
+	max := s.MaxBatch
+	if max <= 0 {
+		max = DefaultMaxBatch
+	}
+	// Allow for generously formatted points
+	body := http.MaxBytesReader(w, r.Body, int64(max)*256+1024)
+	var req BatchRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Points) > max {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("more than %d points", max))
+		return
+	}
+	ls := make([]s2.LatLng, len(req.Points))
+	for i, p := range req.Points {
+		if err := p.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("point %d: %v", i, err))
+			return
+		}
+		ls[i] = p.latLng()
+	}
+
+	results, err := g.ReverseGeocodeBatch(r.Context(), ls, runtime.GOMAXPROCS(0))
+	if err != nil {
+		writeQueryError(w, r, err)
+		return
+	}
+	res := BatchResponse{Results: make([]BatchResult, len(results))}
+	for i, result := range results {
+		if result.Err != nil {
+			res.Results[i].Error = result.Err.Error()
+			continue
+		}
+		f, err := newFeature(g, result.Feature, withGeometry)
+		if err != nil {
+			res.Results[i].Error = err.Error()
+			continue
+		}
+		res.Results[i].Feature = &f
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// Validate returns an error if the point is not finite or its latitude or
+// longitude is out of range
+func (p Point) Validate() error {
+	if math.IsNaN(p.Lat) || math.IsInf(p.Lat, 0) || math.IsNaN(p.Lon) || math.IsInf(p.Lon, 0) {
+		return fmt.Errorf("invalid point %v,%v", p.Lat, p.Lon)
+	}
+	if p.Lat < -90 || p.Lat > 90 {
+		return fmt.Errorf("latitude %v out of range", p.Lat)
+	}
+	if p.Lon < -180 || p.Lon > 180 {
+		return fmt.Errorf("longitude %v out of range", p.Lon)
+	}
+	return nil
+}
+
+func (p Point) latLng() s2.LatLng {
+	return s2.LatLngFromDegrees(p.Lat, p.Lon)
+}
+
+// newFeature returns the response Feature of f, with its geometry
+// unprojected to longitude/latitude degrees if withGeometry is set
+func newFeature(g *gpkg.GeoPackage, f gpkg.Feature, withGeometry bool) (Feature, error) {
+	feature := Feature{
+		Id:       f.Id,
+		Columns:  make(map[string]any, len(f.Columns)),
+		Distance: f.Distance,
+	}
+	for i, col := range f.Columns {
+		feature.Columns[col] = f.Values[i]
+	}
+	if withGeometry {
+		gm, err := g.Unproject(f.Geometry)
+		if err != nil {
+			return feature, fmt.Errorf("feature %d: %w", f.Id, err)
+		}
+		feature.Geometry, err = gm.MarshalJSON()
+		if err != nil {
+			return feature, fmt.Errorf("feature %d: %w", f.Id, err)
+		}
+	}
+	return feature, nil
+}
+
+// writeQueryError writes the error of a query, which is not written if the
+// request was canceled, as the client has gone away
+func writeQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
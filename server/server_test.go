@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"github.com/smilyorg/tinygpkg/writer"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	path := testgpkg.Create(t, testgpkg.Options{Encoding: writer.TWKB, Precision: 3})
+	s, err := New([]Dataset{
+		{Name: "places", Path: path, Columns: []string{"name", "rank"}},
+		{Name: "names", Path: path, Table: "places", Columns: []string{"name"}, MaxDistance: 200000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func serve(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestReverse(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		target string
+		status int
+		want   string
+	}{
+		{
+			target: "/reverse?lat=5&lon=5",
+			status: http.StatusOK,
+			want:   `{"fid":1,"columns":{"name":"outer","rank":1}}`,
+		},
+		{
+			target: "/reverse?lat=5&lon=25&dataset=names",
+			status: http.StatusOK,
+			want:   `{"fid":3,"columns":{"name":"east"}}`,
+		},
+		{
+			target: "/reverse?lat=5&lon=11&dataset=names",
+			status: http.StatusOK,
+			want:   `{"fid":1,"columns":{"name":"outer"},"distance":110771.90665795513}`,
+		},
+		{
+			target: "/reverse?lat=5&lon=15",
+			status: http.StatusNotFound,
+			want:   `{"error":"not found"}`,
+		},
+		{
+			target: "/reverse?lat=5",
+			status: http.StatusBadRequest,
+			want:   `{"error":"invalid or missing lat and lon parameters"}`,
+		},
+		{
+			target: "/reverse?lat=NaN&lon=5",
+			status: http.StatusBadRequest,
+			want:   `{"error":"invalid point NaN,5"}`,
+		},
+		{
+			target: "/reverse?lat=5&lon=Inf",
+			status: http.StatusBadRequest,
+			want:   `{"error":"invalid point 5,+Inf"}`,
+		},
+		{
+			target: "/reverse?lat=95&lon=5",
+			status: http.StatusBadRequest,
+			want:   `{"error":"latitude 95 out of range"}`,
+		},
+		{
+			target: "/reverse?lat=5&lon=5&dataset=missing",
+			status: http.StatusNotFound,
+			want:   `{"error":"unknown dataset \"missing\""}`,
+		},
+	}
+	for _, tt := range tests {
+		w := serve(s, http.MethodGet, tt.target, "")
+		if w.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.target, w.Code, tt.status)
+		}
+		if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.target, got, tt.want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: got content type %q", tt.target, ct)
+		}
+	}
+}
+
+func TestReverseGeometry(t *testing.T) {
+	s := newTestServer(t)
+	w := serve(s, http.MethodGet, "/reverse?lat=5&lon=25&geometry=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var f Feature
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	g, err := geom.UnmarshalGeoJSON(f.Geometry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := geom.UnmarshalWKT("POLYGON((20 0,30 0,30 10,20 10,20 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !geom.ExactEquals(g, want) {
+		t.Errorf("got geometry %s, want %s", g.AsText(), want.AsText())
+	}
+}
+
+func TestReverseBatch(t *testing.T) {
+	s := newTestServer(t)
+	w := serve(s, http.MethodPost, "/reverse", `{"points":[{"lat":5,"lon":5},{"lat":5,"lon":15},{"lat":5,"lon":25}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var res BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	want := BatchResponse{Results: []BatchResult{
+		{Feature: &Feature{Id: 1, Columns: map[string]any{"name": "outer", "rank": 1.0}}},
+		{Error: "not found"},
+		{Feature: &Feature{Id: 3, Columns: map[string]any{"name": "east", "rank": 3.0}}},
+	}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("got %s", w.Body)
+	}
+
+	s.MaxBatch = 2
+	w = serve(s, http.MethodPost, "/reverse", `{"points":[{"lat":5,"lon":5},{"lat":5,"lon":15},{"lat":5,"lon":25}]}`)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d for too many points, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	w = serve(s, http.MethodPost, "/reverse", `{"points":`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for invalid body, want %d", w.Code, http.StatusBadRequest)
+	}
+	w = serve(s, http.MethodPut, "/reverse", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got status %d for PUT, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestReverseCanceled(t *testing.T) {
+	s := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	want := `{"fid":1,"columns":{"name":"outer","rank":1}}`
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/reverse?lat=5&lon=5", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		// The query either completes or is interrupted without a response
+		got := strings.TrimSpace(w.Body.String())
+		if got == "" {
+			continue
+		}
+		if w.Code != http.StatusOK || got != want {
+			t.Errorf("got response %d %s for canceled request, want none or %s", w.Code, got, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Encoding: writer.TWKB, Precision: 3})
+	if _, err := New(nil); err == nil {
+		t.Error("expected error for no datasets")
+	}
+	_, err := New([]Dataset{
+		{Name: "a", Path: path, Columns: []string{"name"}},
+		{Name: "a", Path: path, Columns: []string{"name"}},
+	})
+	if err == nil {
+		t.Error("expected error for duplicate datasets")
+	}
+	_, err = New([]Dataset{{Name: "a", Path: path, Columns: []string{"missing"}}})
+	if err == nil {
+		t.Error("expected error for unknown column")
+	}
+}
@@ -0,0 +1,164 @@
+package simplify
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// douglasPeucker simplifies the line pts with the Douglas–Peucker
+// algorithm, keeping the points further than tolerance from the
+// simplified line. The first and last points are always kept.
+func douglasPeucker(pts []geom.XY, tolerance float64) []geom.XY {
+	if len(pts) <= 2 {
+		return pts
+	}
+	if pts[0] == pts[len(pts)-1] {
+		// A closed line has no baseline, so it is split at the point
+		// furthest from its start, which is kept.
+		k, _ := furthest(pts, 0, len(pts)-1, func(p geom.XY) float64 {
+			return p.Sub(pts[0]).Length()
+		})
+		if k <= 0 {
+			return []geom.XY{pts[0], pts[len(pts)-1]}
+		}
+		a := douglasPeucker(pts[:k+1], tolerance)
+		b := douglasPeucker(pts[k:], tolerance)
+		return append(a[:len(a)-1:len(a)-1], b...)
+	}
+
+	keep := make([]bool, len(pts))
+	keep[0] = true
+	keep[len(pts)-1] = true
+	stack := [][2]int{{0, len(pts) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		a, b := pts[s[0]], pts[s[1]]
+		k, d := furthest(pts, s[0], s[1], func(p geom.XY) float64 {
+			return segmentDistance(p, a, b)
+		})
+		if k < 0 || d <= tolerance {
+			continue
+		}
+		keep[k] = true
+		stack = append(stack, [2]int{s[0], k}, [2]int{k, s[1]})
+	}
+
+	var out []geom.XY
+	for i, p := range pts {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// furthest returns the index of the point between the indices i and j,
+// exclusive, with the largest distance d, or -1 if there are none
+func furthest(pts []geom.XY, i, j int, d func(p geom.XY) float64) (int, float64) {
+	k, max := -1, -1.0
+	for n := i + 1; n < j; n++ {
+		if dn := d(pts[n]); dn > max {
+			k, max = n, dn
+		}
+	}
+	return k, max
+}
+
+// segmentDistance returns the distance of p from the segment a-b
+func segmentDistance(p, a, b geom.XY) float64 {
+	ab := b.Sub(a)
+	l := ab.Dot(ab)
+	if l == 0 {
+		return p.Sub(a).Length()
+	}
+	t := math.Max(0, math.Min(1, p.Sub(a).Dot(ab)/l))
+	return p.Sub(a.Add(ab.Scale(t))).Length()
+}
+
+// visvalingam simplifies the line pts with the Visvalingam–Whyatt
+// algorithm, repeatedly removing the point forming the triangle with the
+// smallest area with its neighbours, while that area is less than
+// tolerance squared. The first and last points are always kept.
+func visvalingam(pts []geom.XY, tolerance float64) []geom.XY {
+	if len(pts) <= 2 {
+		return pts
+	}
+	threshold := tolerance * tolerance
+
+	vs := make([]vertex, len(pts))
+	h := make(vertexHeap, 0, len(pts)-2)
+	for i := range vs {
+		vs[i] = vertex{i: i, prev: i - 1, next: i + 1, index: -1}
+		if i > 0 && i < len(pts)-1 {
+			vs[i].area = triangleArea(pts[i-1], pts[i], pts[i+1])
+			h = append(h, &vs[i])
+			vs[i].index = len(h) - 1
+		}
+	}
+	heap.Init(&h)
+
+	// The area of a point is at least that of the last removed point, so
+	// that points are not kept because of the removal of their neighbours.
+	min := 0.0
+	update := func(v *vertex) {
+		if v.index < 0 {
+			return
+		}
+		v.area = math.Max(min, triangleArea(pts[v.prev], pts[v.i], pts[v.next]))
+		heap.Fix(&h, v.index)
+	}
+	removed := make([]bool, len(pts))
+	for h.Len() > 0 && h[0].area < threshold {
+		v := heap.Pop(&h).(*vertex)
+		min = v.area
+		removed[v.i] = true
+		vs[v.prev].next = v.next
+		vs[v.next].prev = v.prev
+		update(&vs[v.prev])
+		update(&vs[v.next])
+	}
+
+	var out []geom.XY
+	for i, p := range pts {
+		if !removed[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func triangleArea(a, b, c geom.XY) float64 {
+	return math.Abs(b.Sub(a).Cross(c.Sub(a))) / 2
+}
+
+type vertex struct {
+	i, prev, next int
+	area          float64
+	index         int
+}
+
+// vertexHeap is a min-heap of vertices ordered by area
+type vertexHeap []*vertex
+
+func (h vertexHeap) Len() int           { return len(h) }
+func (h vertexHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vertexHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *vertexHeap) Push(x any) {
+	v := x.(*vertex)
+	v.index = len(*h)
+	*h = append(*h, v)
+}
+func (h *vertexHeap) Pop() any {
+	old := *h
+	v := old[len(old)-1]
+	v.index = -1
+	*h = old[:len(old)-1]
+	return v
+}
@@ -0,0 +1,100 @@
+package simplify
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func xys(fs ...float64) []geom.XY {
+	var pts []geom.XY
+	for i := 0; i < len(fs); i += 2 {
+		pts = append(pts, geom.XY{X: fs[i], Y: fs[i+1]})
+	}
+	return pts
+}
+
+func TestDouglasPeucker(t *testing.T) {
+	tests := []struct {
+		name      string
+		pts       []geom.XY
+		tolerance float64
+		want      []geom.XY
+	}{
+		{
+			name:      "straight",
+			pts:       xys(0, 0, 1, 0.1, 2, 0, 3, -0.1, 4, 0),
+			tolerance: 0.5,
+			want:      xys(0, 0, 4, 0),
+		},
+		{
+			name:      "peak",
+			pts:       xys(0, 0, 1, 0.1, 2, 2, 3, 0.1, 4, 0),
+			tolerance: 1,
+			want:      xys(0, 0, 2, 2, 4, 0),
+		},
+		{
+			name:      "zero tolerance",
+			pts:       xys(0, 0, 1, 0.1, 2, 0),
+			tolerance: 0,
+			want:      xys(0, 0, 1, 0.1, 2, 0),
+		},
+		{
+			name:      "closed",
+			pts:       xys(0, 0, 2, 0, 4, 0.1, 4, 4, 0, 4, 0, 0),
+			tolerance: 0.5,
+			want:      xys(0, 0, 4, 0.1, 4, 4, 0, 4, 0, 0),
+		},
+		{
+			name:      "two points",
+			pts:       xys(0, 0, 1, 1),
+			tolerance: 1,
+			want:      xys(0, 0, 1, 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := douglasPeucker(tt.pts, tt.tolerance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisvalingam(t *testing.T) {
+	tests := []struct {
+		name      string
+		pts       []geom.XY
+		tolerance float64
+		want      []geom.XY
+	}{
+		{
+			name:      "straight",
+			pts:       xys(0, 0, 1, 0.1, 2, 0, 3, -0.1, 4, 0),
+			tolerance: 0.5,
+			want:      xys(0, 0, 4, 0),
+		},
+		{
+			name:      "peak",
+			pts:       xys(0, 0, 1, 0.1, 2, 2, 3, 0.1, 4, 0),
+			tolerance: 1,
+			want:      xys(0, 0, 2, 2, 4, 0),
+		},
+		{
+			name:      "zero tolerance",
+			pts:       xys(0, 0, 1, 0.1, 2, 0),
+			tolerance: 0,
+			want:      xys(0, 0, 1, 0.1, 2, 0),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := visvalingam(tt.pts, tt.tolerance)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+// Package simplify simplifies polygon datasets while preserving the
+// borders shared between neighbouring polygons, to prepare them for
+// writing as compact GeoPackages.
+package simplify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// Method is a line simplification algorithm
+type Method int
+
+const (
+	// DouglasPeucker removes points closer than Tolerance to the
+	// simplified line
+	DouglasPeucker Method = iota
+	// Visvalingam removes points forming triangles with their neighbours
+	// with an area smaller than Tolerance squared
+	Visvalingam
+)
+
+func (m Method) String() string {
+	switch m {
+	case DouglasPeucker:
+		return "douglas-peucker"
+	case Visvalingam:
+		return "visvalingam"
+	default:
+		return fmt.Sprintf("Method(%d)", int(m))
+	}
+}
+
+// Options configures Polygons
+type Options struct {
+	Method Method
+	// Tolerance is in the units of the coordinates, e.g. degrees
+	Tolerance float64
+}
+
+// Polygons simplifies the polygons and multipolygons of gs as one
+// dataset and returns the simplified geometries in the same order, made
+// valid with MakeValid.
+//
+// The rings are split into arcs at the junctions where neighbouring rings
+// meet, and each arc is simplified once, so that borders shared by
+// multiple polygons are simplified the same way and no gaps or overlaps
+// open up between them. The junctions themselves are kept. Rings
+// collapsing to less than three points are removed, along with polygons
+// whose exterior ring is removed.
+//
+// Other geometries are returned as they are. Z and M coordinates are
+// dropped.
+func Polygons(gs []geom.Geometry, opts Options) ([]geom.Geometry, error) {
+	var fn func(pts []geom.XY, tolerance float64) []geom.XY
+	switch opts.Method {
+	case DouglasPeucker:
+		fn = douglasPeucker
+	case Visvalingam:
+		fn = visvalingam
+	default:
+		return nil, fmt.Errorf("unsupported method %s", opts.Method)
+	}
+	if opts.Tolerance < 0 || math.IsNaN(opts.Tolerance) {
+		return nil, fmt.Errorf("invalid tolerance %v", opts.Tolerance)
+	}
+
+	t := newTopology()
+	shapes := make([][][][]geom.XY, len(gs))
+	for i, g := range gs {
+		shapes[i] = polygonRings(g)
+		for _, p := range shapes[i] {
+			for _, r := range p {
+				t.addRing(r)
+			}
+		}
+	}
+
+	out := make([]geom.Geometry, len(gs))
+	for i, g := range gs {
+		if shapes[i] == nil {
+			out[i] = g
+			continue
+		}
+		var polys []geom.Polygon
+		for _, p := range shapes[i] {
+			var rings []geom.LineString
+			for n, r := range p {
+				sr := t.simplifyRing(r, opts.Tolerance, fn)
+				if len(sr) < 4 {
+					if n == 0 {
+						break
+					}
+					continue
+				}
+				ls, err := geom.NewLineString(sequence(sr), geom.DisableAllValidations)
+				if err != nil {
+					return nil, err
+				}
+				rings = append(rings, ls)
+			}
+			if len(rings) == 0 {
+				continue
+			}
+			poly, err := geom.NewPolygon(rings, geom.DisableAllValidations)
+			if err != nil {
+				return nil, err
+			}
+			polys = append(polys, poly)
+		}
+
+		var sg geom.Geometry
+		if g.IsPolygon() && len(polys) == 1 {
+			sg = polys[0].AsGeometry()
+		} else if g.IsPolygon() && len(polys) == 0 {
+			sg = geom.Polygon{}.AsGeometry()
+		} else {
+			mp, err := geom.NewMultiPolygon(polys, geom.DisableAllValidations)
+			if err != nil {
+				return nil, err
+			}
+			sg = mp.AsGeometry()
+		}
+		vg, err := MakeValid(sg)
+		if err != nil {
+			return nil, fmt.Errorf("geometry %d: %w", i, err)
+		}
+		out[i] = vg
+	}
+	return out, nil
+}
+
+// polygonRings returns the closed rings of each polygon of g without
+// repeated points, or nil if g is not a polygon or multipolygon
+func polygonRings(g geom.Geometry) [][][]geom.XY {
+	var polys []geom.Polygon
+	switch {
+	case g.IsPolygon():
+		polys = []geom.Polygon{g.MustAsPolygon()}
+	case g.IsMultiPolygon():
+		polys = g.MustAsMultiPolygon().Dump()
+	default:
+		return nil
+	}
+	out := [][][]geom.XY{}
+	for _, p := range polys {
+		var rings [][]geom.XY
+		for _, r := range p.DumpRings() {
+			seq := r.Coordinates()
+			var pts []geom.XY
+			for i := 0; i < seq.Length(); i++ {
+				xy := seq.GetXY(i)
+				if len(pts) > 0 && pts[len(pts)-1] == xy {
+					continue
+				}
+				pts = append(pts, xy)
+			}
+			if len(pts) > 0 && pts[0] != pts[len(pts)-1] {
+				pts = append(pts, pts[0])
+			}
+			if len(pts) < 4 {
+				if len(rings) == 0 {
+					break
+				}
+				continue
+			}
+			rings = append(rings, pts)
+		}
+		if len(rings) > 0 {
+			out = append(out, rings)
+		}
+	}
+	return out
+}
+
+func sequence(pts []geom.XY) geom.Sequence {
+	fs := make([]float64, 0, len(pts)*2)
+	for _, p := range pts {
+		fs = append(fs, p.X, p.Y)
+	}
+	return geom.NewSequence(fs, geom.DimXY)
+}
+
+// topology tracks the neighbours of the points of all rings, to find the
+// junctions where rings meet, and the simplified arcs between them
+type topology struct {
+	neighbours map[geom.XY]neighbours
+	arcs       map[string][]geom.XY
+}
+
+// neighbours are the previous and next points of the first occurrence of
+// a point, in order, and whether any other occurrence had different ones
+type neighbours struct {
+	a, b     geom.XY
+	junction bool
+}
+
+func newTopology() *topology {
+	return &topology{
+		neighbours: make(map[geom.XY]neighbours),
+		arcs:       make(map[string][]geom.XY),
+	}
+}
+
+// addRing adds the points of the closed ring r
+func (t *topology) addRing(r []geom.XY) {
+	n := len(r) - 1
+	for i := 0; i < n; i++ {
+		a, b := r[(i+n-1)%n], r[i+1]
+		if b.Less(a) {
+			a, b = b, a
+		}
+		nb, ok := t.neighbours[r[i]]
+		if !ok {
+			t.neighbours[r[i]] = neighbours{a: a, b: b}
+		} else if !nb.junction && (nb.a != a || nb.b != b) {
+			nb.junction = true
+			t.neighbours[r[i]] = nb
+		}
+	}
+}
+
+// simplifyRing returns the closed ring r with each of its arcs between
+// junctions simplified with fn
+func (t *topology) simplifyRing(r []geom.XY, tolerance float64, fn func(pts []geom.XY, tolerance float64) []geom.XY) []geom.XY {
+	n := len(r) - 1
+
+	// Rotate the ring to start at a junction, or at its smallest point if
+	// it has none, so that rings with the same points have the same arcs.
+	start := -1
+	for i := 0; i < n; i++ {
+		if t.neighbours[r[i]].junction {
+			start = i
+			break
+		}
+	}
+	junctions := start >= 0
+	if !junctions {
+		start = 0
+		for i := 1; i < n; i++ {
+			if r[i].Less(r[start]) {
+				start = i
+			}
+		}
+	}
+	ring := make([]geom.XY, 0, len(r))
+	ring = append(ring, r[start:n]...)
+	ring = append(ring, r[:start+1]...)
+
+	out := []geom.XY{ring[0]}
+	from := 0
+	for i := 1; i < len(ring); i++ {
+		if i < len(ring)-1 && (!junctions || !t.neighbours[ring[i]].junction) {
+			continue
+		}
+		arc := t.arc(ring[from:i+1], tolerance, fn)
+		out = append(out, arc[1:]...)
+		from = i
+	}
+	return out
+}
+
+// arc returns the simplified arc pts, simplifying it with fn the first
+// time it or its reverse is seen
+func (t *topology) arc(pts []geom.XY, tolerance float64, fn func(pts []geom.XY, tolerance float64) []geom.XY) []geom.XY {
+	reversed := isReversed(pts)
+	canonical := pts
+	if reversed {
+		canonical = reverse(pts)
+	}
+	key := arcKey(canonical)
+	s, ok := t.arcs[key]
+	if !ok {
+		s = fn(canonical, tolerance)
+		t.arcs[key] = s
+	}
+	if reversed {
+		return reverse(s)
+	}
+	return s
+}
+
+// isReversed reports whether the arc pts is not in its canonical
+// direction, which starts at its smaller endpoint, or at the smaller of
+// its second and second to last point if it is closed
+func isReversed(pts []geom.XY) bool {
+	first, last := pts[0], pts[len(pts)-1]
+	if first == last && len(pts) > 2 {
+		first, last = pts[1], pts[len(pts)-2]
+	}
+	return last.Less(first)
+}
+
+func reverse(pts []geom.XY) []geom.XY {
+	r := make([]geom.XY, len(pts))
+	for i, p := range pts {
+		r[len(pts)-1-i] = p
+	}
+	return r
+}
+
+func arcKey(pts []geom.XY) string {
+	b := make([]byte, 0, len(pts)*16)
+	for _, p := range pts {
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.X))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(p.Y))
+	}
+	return string(b)
+}
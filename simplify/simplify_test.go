@@ -0,0 +1,119 @@
+package simplify
+
+import (
+	"math"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func unmarshalAll(t *testing.T, wkts ...string) []geom.Geometry {
+	t.Helper()
+	var gs []geom.Geometry
+	for _, wkt := range wkts {
+		g, err := geom.UnmarshalWKT(wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gs = append(gs, g)
+	}
+	return gs
+}
+
+func TestPolygons(t *testing.T) {
+	tests := []struct {
+		name string
+		wkts []string
+		// area of the union of the simplified geometries
+		area float64
+		// number of points of each simplified geometry
+		points []int
+	}{
+		{
+			name: "shared border",
+			wkts: []string{
+				"POLYGON((0 0,5 0,5.1 2,4.9 4,5.1 6,4.9 8,5 10,0 10,0 0))",
+				"POLYGON((5 0,10 0,10 10,5 10,4.9 8,5.1 6,4.9 4,5.1 2,5 0))",
+			},
+			area:   100,
+			points: []int{5, 5},
+		},
+		{
+			name: "island in hole",
+			wkts: []string{
+				"POLYGON((0 0,10 0,10 10,0 10,0 0),(3 3,3.1 5,3 7,7 7,7 3,3 3))",
+				"POLYGON((3 3,7 3,7 7,3 7,3.1 5,3 3))",
+			},
+			area:   100,
+			points: []int{10, 5},
+		},
+		{
+			name: "multipolygon",
+			wkts: []string{
+				"MULTIPOLYGON(((0 0,5 0,5.1 5,5 10,0 10,0 0)),((20 0,23 0,23 3,20 0)))",
+				"POLYGON((5 0,10 0,10 10,5 10,5.1 5,5 0))",
+			},
+			area:   104.5,
+			points: []int{9, 5},
+		},
+		{
+			name: "collapsed",
+			wkts: []string{
+				"POLYGON((0 0,0.1 0,0.1 0.1,0 0))",
+			},
+			area:   0,
+			points: []int{0},
+		},
+		{
+			name: "point",
+			wkts: []string{
+				"POINT(1 2)",
+			},
+			area:   0,
+			points: []int{1},
+		},
+	}
+	for _, method := range []Method{DouglasPeucker, Visvalingam} {
+		for _, tt := range tests {
+			t.Run(method.String()+"/"+tt.name, func(t *testing.T) {
+				gs := unmarshalAll(t, tt.wkts...)
+				got, err := Polygons(gs, Options{Method: method, Tolerance: 1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(gs) {
+					t.Fatalf("got %d geometries, want %d", len(got), len(gs))
+				}
+				for i, g := range got {
+					if n := g.DumpCoordinates().Length(); n != tt.points[i] {
+						t.Errorf("got %d points, want %d for %s", n, tt.points[i], g.AsText())
+					}
+				}
+				union, err := geom.UnionMany(got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if a := union.Area(); math.Abs(a-tt.area) > 1e-9 {
+					t.Errorf("got union area %v, want %v", a, tt.area)
+				}
+				var sum float64
+				for _, g := range got {
+					sum += g.Area()
+				}
+				if math.Abs(sum-tt.area) > 1e-9 {
+					t.Errorf("got total area %v, want %v, polygons overlap or have gaps", sum, tt.area)
+				}
+			})
+		}
+	}
+}
+
+func TestPolygonsInvalidOptions(t *testing.T) {
+	gs := unmarshalAll(t, "POLYGON((0 0,1 0,1 1,0 0))")
+	if _, err := Polygons(gs, Options{Method: Method(99)}); err == nil {
+		t.Error("expected error for unsupported method")
+	}
+	if _, err := Polygons(gs, Options{Tolerance: -1}); err == nil {
+		t.Error("expected error for negative tolerance")
+	}
+}
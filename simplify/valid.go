@@ -0,0 +1,214 @@
+package simplify
+
+import (
+	"math"
+	"sort"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+// MakeValid returns g if it is a valid polygon or multipolygon, and
+// otherwise repairs it, e.g. after simplification made its rings
+// intersect.
+//
+// Each ring is split into simple loops at the points where it intersects
+// itself. The polygons formed by the loops of the exterior rings are
+// unioned and those of the interior rings subtracted from them, and the
+// resulting polygons are unioned with geom.UnionMany. The result is a
+// Polygon, MultiPolygon or an empty GeometryCollection.
+//
+// Other geometries are returned as they are.
+func MakeValid(g geom.Geometry) (geom.Geometry, error) {
+	var polys []geom.Polygon
+	switch {
+	case g.IsPolygon():
+		p := g.MustAsPolygon()
+		if _, err := geom.NewPolygon(p.DumpRings()); err == nil {
+			return g, nil
+		}
+		polys = []geom.Polygon{p}
+	case g.IsMultiPolygon():
+		m := g.MustAsMultiPolygon()
+		if _, err := geom.NewMultiPolygon(m.Dump()); err == nil {
+			return g, nil
+		}
+		polys = m.Dump()
+	default:
+		return g, nil
+	}
+
+	var parts []geom.Geometry
+	for _, p := range polys {
+		var shell []geom.Geometry
+		var holes []geom.Geometry
+		for i, r := range p.DumpRings() {
+			loops := ringLoops(r)
+			if i == 0 {
+				shell = loops
+			} else {
+				holes = append(holes, loops...)
+			}
+		}
+		if len(shell) == 0 {
+			continue
+		}
+		part, err := geom.UnionMany(shell)
+		if err != nil {
+			return geom.Geometry{}, err
+		}
+		if len(holes) > 0 {
+			h, err := geom.UnionMany(holes)
+			if err != nil {
+				return geom.Geometry{}, err
+			}
+			part, err = geom.Difference(part, h)
+			if err != nil {
+				return geom.Geometry{}, err
+			}
+		}
+		parts = append(parts, part)
+	}
+	return geom.UnionMany(parts)
+}
+
+// ringLoops returns the valid polygons formed by the simple loops of the
+// ring r, after noding it at its self-intersections. Loops without area
+// are dropped.
+func ringLoops(r geom.LineString) []geom.Geometry {
+	seq := r.Coordinates()
+	var pts []geom.XY
+	for i := 0; i < seq.Length(); i++ {
+		xy := seq.GetXY(i)
+		if len(pts) > 0 && pts[len(pts)-1] == xy {
+			continue
+		}
+		pts = append(pts, xy)
+	}
+	if len(pts) < 4 {
+		return nil
+	}
+	if pts[0] != pts[len(pts)-1] {
+		pts = append(pts, pts[0])
+	}
+	pts = node(pts)
+
+	// Walk the ring and cut off a loop whenever a point is revisited
+	var loops []geom.Geometry
+	emit := func(loop []geom.XY) {
+		if len(loop) < 4 {
+			return
+		}
+		ls, err := geom.NewLineString(sequence(loop))
+		if err != nil {
+			return
+		}
+		p, err := geom.NewPolygon([]geom.LineString{ls})
+		if err != nil || p.Area() == 0 {
+			return
+		}
+		loops = append(loops, p.AsGeometry())
+	}
+	path := make([]geom.XY, 0, len(pts))
+	pos := make(map[geom.XY]int)
+	for _, p := range pts[:len(pts)-1] {
+		if i, ok := pos[p]; ok {
+			loop := append(append([]geom.XY{}, path[i:]...), p)
+			emit(loop)
+			for _, q := range path[i+1:] {
+				delete(pos, q)
+			}
+			path = path[:i+1]
+			continue
+		}
+		pos[p] = len(path)
+		path = append(path, p)
+	}
+	emit(append(path, path[0]))
+	return loops
+}
+
+// node returns the closed ring pts with the points where its segments
+// intersect each other inserted into both segments
+func node(pts []geom.XY) []geom.XY {
+	n := len(pts) - 1
+	type cut struct {
+		t float64
+		p geom.XY
+	}
+	cuts := make([][]cut, n)
+
+	// Sweep the segments ordered by their minimum x
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	minX := func(i int) float64 { return math.Min(pts[i].X, pts[i+1].X) }
+	maxX := func(i int) float64 { return math.Max(pts[i].X, pts[i+1].X) }
+	sort.Slice(order, func(a, b int) bool { return minX(order[a]) < minX(order[b]) })
+
+	for a, i := range order {
+		for _, j := range order[a+1:] {
+			if minX(j) > maxX(i) {
+				break
+			}
+			if j == i+1 || i == j+1 || (i == 0 && j == n-1) || (j == 0 && i == n-1) {
+				continue
+			}
+			t, u, p, ok := intersection(pts[i], pts[i+1], pts[j], pts[j+1])
+			if !ok {
+				continue
+			}
+			if t > 0 && t < 1 {
+				cuts[i] = append(cuts[i], cut{t, p})
+			}
+			if u > 0 && u < 1 {
+				cuts[j] = append(cuts[j], cut{u, p})
+			}
+		}
+	}
+
+	out := make([]geom.XY, 0, len(pts))
+	for i := 0; i < n; i++ {
+		out = append(out, pts[i])
+		cs := cuts[i]
+		sort.Slice(cs, func(a, b int) bool { return cs[a].t < cs[b].t })
+		for _, c := range cs {
+			if out[len(out)-1] != c.p {
+				out = append(out, c.p)
+			}
+		}
+	}
+	return append(out, pts[n])
+}
+
+// intersection returns the point p where the segments a-b and c-d
+// intersect, at the parameter t along a-b and u along c-d. Points at the
+// ends of the segments are returned exactly. Parallel segments are
+// treated as not intersecting.
+func intersection(a, b, c, d geom.XY) (t, u float64, p geom.XY, ok bool) {
+	ab := b.Sub(a)
+	cd := d.Sub(c)
+	den := ab.Cross(cd)
+	if den == 0 {
+		return 0, 0, geom.XY{}, false
+	}
+	ac := c.Sub(a)
+	t = ac.Cross(cd) / den
+	u = ac.Cross(ab) / den
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return 0, 0, geom.XY{}, false
+	}
+	switch {
+	case t == 0:
+		p = a
+	case t == 1:
+		p = b
+	case u == 0:
+		p = c
+	case u == 1:
+		p = d
+	default:
+		p = a.Add(ab.Scale(t))
+	}
+	return t, u, p, true
+}
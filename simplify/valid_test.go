@@ -0,0 +1,46 @@
+package simplify
+
+import (
+	"math"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+)
+
+func TestMakeValid(t *testing.T) {
+	tests := []struct {
+		name string
+		wkt  string
+		area float64
+		n    int
+	}{
+		{name: "valid", wkt: "POLYGON((0 0,4 0,4 4,0 4,0 0),(1 1,2 1,2 2,1 2,1 1))", area: 15, n: 1},
+		{name: "bowtie", wkt: "POLYGON((0 0,2 2,2 0,0 2,0 0))", area: 2, n: 2},
+		{name: "bowtie with vertex", wkt: "POLYGON((0 0,4 0,4 4,2 0,0 4,0 0))", area: 8, n: 2},
+		{name: "hole crossing shell", wkt: "POLYGON((0 0,4 0,4 4,0 4,0 0),(3 3,5 3,5 5,3 5,3 3))", area: 15, n: 1},
+		{name: "overlapping polygons", wkt: "MULTIPOLYGON(((0 0,2 0,2 2,0 2,0 0)),((1 1,3 1,3 3,1 3,1 1)))", area: 7, n: 1},
+		{name: "spike", wkt: "POLYGON((0 0,2 0,2 2,3 2,2 2,0 2,0 0))", area: 4, n: 1},
+		{name: "collapsed", wkt: "POLYGON((0 0,1 0,2 0,0 0))", area: 0, n: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := geom.UnmarshalWKT(tt.wkt, geom.DisableAllValidations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := MakeValid(g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := geom.UnmarshalWKB(v.AsBinary()); err != nil {
+				t.Errorf("got invalid %s: %v", v.AsText(), err)
+			}
+			if a := v.Area(); math.Abs(a-tt.area) > 1e-9 {
+				t.Errorf("got area %v, want %v for %s", a, tt.area, v.AsText())
+			}
+			if n := len(v.Dump()); n != tt.n {
+				t.Errorf("got %d polygons, want %d for %s", n, tt.n, v.AsText())
+			}
+		})
+	}
+}
@@ -0,0 +1,387 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// ConvertOptions configures Convert
+type ConvertOptions struct {
+	// Tables are the feature tables to convert, all tables registered in
+	// "gpkg_geometry_columns" if empty
+	Tables []string
+	// Precision is the number of decimal digits of the XY coordinates
+	// kept, e.g. 3 for about 100 meters in degrees. If it is nil,
+	// DefaultPrecision is used for the tables in geographic coordinate
+	// systems and 0 for the others, like Table.Precision.
+	Precision *int
+}
+
+// ConvertStats reports the sizes before and after a conversion
+type ConvertStats struct {
+	// Features is the number of converted geometries
+	Features int64
+	// BlobsBefore and BlobsAfter are the total sizes of the converted
+	// geometry blobs in bytes
+	BlobsBefore int64
+	BlobsAfter  int64
+	// FileBefore and FileAfter are the sizes of the GeoPackage files
+	FileBefore int64
+	FileAfter  int64
+}
+
+// convertBatch is the number of features read at a time while converting
+const convertBatch = 1000
+
+// Convert rewrites the standard WKB geometry blobs of the feature tables
+// of the GeoPackage at src as TWKB geometry blobs with the ExtensionTWKB
+// extension registered. Attributes are kept as they are and the spatial
+// indexes are updated to the envelopes of the rounded geometries.
+// Geometries that are already extended blobs are left unchanged.
+//
+// If dst is empty or the same as src, src is converted in place,
+// otherwise it is copied to dst first, which must not exist, including
+// the changes still in the write-ahead log of src. The file is
+// vacuumed after the conversion to reclaim the space saved. If the
+// conversion fails, dst is removed, or the changes to src are rolled back
+// if it is converted in place.
+func Convert(src, dst string, opts ConvertOptions) (ConvertStats, error) {
+	var stats ConvertStats
+	fi, err := os.Stat(src)
+	if err != nil {
+		return stats, err
+	}
+	stats.FileBefore = fi.Size()
+
+	path := src
+	if dst != "" && !samePath(src, dst) {
+		if err := copyDatabase(src, dst); err != nil {
+			return stats, err
+		}
+		path = dst
+	}
+
+	if err := convertFile(path, opts, &stats); err != nil {
+		if path != src {
+			os.Remove(path)
+		}
+		return stats, err
+	}
+
+	fi, err = os.Stat(path)
+	if err != nil {
+		return stats, err
+	}
+	stats.FileAfter = fi.Size()
+	return stats, nil
+}
+
+// convertFile converts the GeoPackage at path in a single transaction,
+// which is rolled back on error
+func convertFile(path string, opts ConvertOptions, stats *ConvertStats) error {
+	w, err := Open(path)
+	if err != nil {
+		return err
+	}
+	err = w.convert(opts, stats)
+	if err == nil {
+		err = w.commit()
+	}
+	if err == nil {
+		err = sqlitex.ExecuteTransient(w.conn, "VACUUM", nil)
+	}
+	if err != nil {
+		w.conn.Close()
+		return err
+	}
+	return w.conn.Close()
+}
+
+func (w *GeoPackage) convert(opts ConvertOptions, stats *ConvertStats) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	tables, err := w.geometryColumns(opts.Tables)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return errors.New("no feature tables to convert")
+	}
+	err = w.exec(`
+		CREATE TABLE IF NOT EXISTS gpkg_extensions (
+			table_name TEXT,
+			column_name TEXT,
+			extension_name TEXT NOT NULL,
+			definition TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			CONSTRAINT ge_tce UNIQUE (table_name, column_name, extension_name)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		p := precision(0, t.srs)
+		if opts.Precision != nil {
+			p = *opts.Precision
+		}
+		if err := w.convertTable(t, p, stats); err != nil {
+			return fmt.Errorf("error converting %s: %w", t.table, err)
+		}
+	}
+	return nil
+}
+
+type geometryColumn struct {
+	table  string
+	column string
+	fid    string
+	srs    SpatialRefSys
+}
+
+// geometryColumns returns the geometry columns of the tables, or of all
+// tables if tables is empty
+func (w *GeoPackage) geometryColumns(tables []string) ([]geometryColumn, error) {
+	var cols []geometryColumn
+	err := sqlitex.Execute(w.conn, `
+		SELECT g.table_name, g.column_name, g.srs_id,
+			ifnull(r.organization, ''), ifnull(r.organization_coordsys_id, 0),
+			ifnull(r.definition, '')
+		FROM gpkg_geometry_columns g
+		LEFT JOIN gpkg_spatial_ref_sys r ON r.srs_id = g.srs_id
+		ORDER BY g.table_name`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			cols = append(cols, geometryColumn{
+				table:  stmt.ColumnText(0),
+				column: stmt.ColumnText(1),
+				srs: SpatialRefSys{
+					Id:             stmt.ColumnInt32(2),
+					Organization:   stmt.ColumnText(3),
+					OrganizationId: stmt.ColumnInt64(4),
+					Definition:     stmt.ColumnText(5),
+				},
+			})
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) > 0 {
+		var selected []geometryColumn
+		for _, t := range tables {
+			found := false
+			for _, c := range cols {
+				if c.table == t {
+					selected = append(selected, c)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("table %s not found in gpkg_geometry_columns", t)
+			}
+		}
+		cols = selected
+	}
+	for i := range cols {
+		fid, err := sqlutil.PrimaryKey(w.conn, cols[i].table)
+		if err != nil {
+			return nil, err
+		}
+		cols[i].fid = fid
+	}
+	return cols, nil
+}
+
+// convertTable converts the geometries of the table in batches ordered by
+// their id, so that rows are not updated while they are being read
+func (w *GeoPackage) convertTable(t geometryColumn, precision int, stats *ConvertStats) error {
+	table := sqlutil.QuoteIdent(t.table)
+	fid := sqlutil.QuoteIdent(t.fid)
+	geomCol := sqlutil.QuoteIdent(t.column)
+	sel := w.conn.Prep(`
+		SELECT ` + fid + `, ` + geomCol + `
+		FROM ` + table + `
+		WHERE ` + fid + ` > :fid AND ` + geomCol + ` NOT NULL
+		ORDER BY ` + fid + `
+		LIMIT ` + fmt.Sprint(convertBatch))
+	upd := w.conn.Prep(`
+		UPDATE ` + table + `
+		SET ` + geomCol + ` = :geom
+		WHERE ` + fid + ` = :fid`)
+
+	type row struct {
+		fid int64
+		b   []byte
+	}
+	rows := make([]row, 0, convertBatch)
+	last := int64(-1 << 63)
+	for {
+		rows = rows[:0]
+		sel.SetInt64(":fid", last)
+		for {
+			if exists, err := sel.Step(); err != nil {
+				sel.Reset()
+				return err
+			} else if !exists {
+				break
+			}
+			b := make([]byte, sel.ColumnLen(1))
+			sel.ColumnBytes(1, b)
+			rows = append(rows, row{fid: sel.ColumnInt64(0), b: b})
+		}
+		if err := sel.Reset(); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		last = rows[len(rows)-1].fid
+
+		for _, r := range rows {
+			b, ok, err := toTWKB(r.b, precision)
+			if err != nil {
+				return fmt.Errorf("feature %d: %w", r.fid, err)
+			}
+			if !ok {
+				continue
+			}
+			upd.SetInt64(":fid", r.fid)
+			upd.SetBytes(":geom", b)
+			if _, err := upd.Step(); err != nil {
+				upd.Reset()
+				return fmt.Errorf("feature %d: %w", r.fid, err)
+			}
+			if err := upd.Reset(); err != nil {
+				return err
+			}
+			stats.Features++
+			stats.BlobsBefore += int64(len(r.b))
+			stats.BlobsAfter += int64(len(b))
+		}
+	}
+
+	rtree := "rtree_" + t.table + "_" + t.column
+	exists, err := w.hasTable(rtree)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// Refresh the index in case the table has no triggers updating it
+		err := w.exec(`
+			INSERT OR REPLACE INTO ` + sqlutil.QuoteIdent(rtree) + `
+			SELECT ` + fid + `, ST_MinX(` + geomCol + `), ST_MaxX(` + geomCol + `), ST_MinY(` + geomCol + `), ST_MaxY(` + geomCol + `)
+			FROM ` + table + `
+			WHERE ` + geomCol + ` NOT NULL AND NOT ST_IsEmpty(` + geomCol + `);
+		`)
+		if err != nil {
+			return fmt.Errorf("error updating spatial index: %w", err)
+		}
+	}
+
+	return w.addExtension(t.table, t.column, ExtensionTWKB,
+		"https://github.com/TWKB/Specification/blob/master/twkb.md", "read-write")
+}
+
+// hasTable reports whether a table with the name exists
+func (w *GeoPackage) hasTable(name string) (bool, error) {
+	exists := false
+	err := sqlitex.Execute(w.conn, `
+		SELECT 1
+		FROM sqlite_master
+		WHERE type = 'table' AND name = ?`, &sqlitex.ExecOptions{
+		Args: []any{name},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			exists = true
+			return nil
+		},
+	})
+	return exists, err
+}
+
+// toTWKB converts the standard geometry blob b to a TWKB geometry blob
+// with the same SRS id. It returns false if b is not a standard blob.
+func toTWKB(b []byte, precision int) ([]byte, bool, error) {
+	h, n, err := binary.ParseHeader(b)
+	if err != nil {
+		return nil, false, err
+	}
+	if h.Type() != binary.StandardType {
+		return nil, false, nil
+	}
+	g, err := binary.UnmarshalPayload(&h, b[n:], geom.DisableAllValidations)
+	if err != nil {
+		return nil, false, err
+	}
+	tb, err := binary.MarshalTWKB(h.SrsId, g, precision)
+	if err != nil {
+		return nil, false, err
+	}
+	return tb, true, nil
+}
+
+func samePath(a, b string) bool {
+	aa, err := filepath.Abs(a)
+	if err != nil {
+		return a == b
+	}
+	ab, err := filepath.Abs(b)
+	if err != nil {
+		return a == b
+	}
+	return aa == ab
+}
+
+// copyDatabase copies the SQLite database src to dst, which must not
+// exist, and removes dst if the copy fails. It uses the backup API rather
+// than copying the file, so that the changes in the write-ahead log of
+// src that are not checkpointed yet are copied too.
+func copyDatabase(src, dst string) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := backup(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// backup copies all pages of the database src to the database dst
+func backup(src, dst string) error {
+	in, err := sqlite.OpenConn(src, sqlite.OpenReadOnly)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := sqlite.OpenConn(dst, sqlite.OpenReadWrite)
+	if err != nil {
+		return err
+	}
+	b, err := sqlite.NewBackup(out, "main", in, "main")
+	if err != nil {
+		out.Close()
+		return err
+	}
+	_, err = b.Step(-1)
+	b.Close()
+	return errors.Join(err, out.Close())
+}
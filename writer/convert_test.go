@@ -0,0 +1,253 @@
+package writer_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"github.com/smilyorg/tinygpkg/writer"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// precision returns a pointer to p for ConvertOptions.Precision
+func precision(p int) *int {
+	return &p
+}
+
+// blobTypes returns the types of the non-NULL geometry blobs of places
+func blobTypes(t *testing.T, path string) []binary.Type {
+	t.Helper()
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var types []binary.Type
+	err = sqlitex.ExecuteTransient(conn, "SELECT geom FROM places ORDER BY fid", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			b := make([]byte, stmt.ColumnLen(0))
+			stmt.ColumnBytes(0, b)
+			h, _, err := binary.ParseHeader(b)
+			if err != nil {
+				return err
+			}
+			types = append(types, h.Type())
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return types
+}
+
+func TestConvert(t *testing.T) {
+	src := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	dst := filepath.Join(t.TempDir(), "twkb.gpkg")
+
+	stats, err := writer.Convert(src, dst, writer.ConvertOptions{Precision: precision(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Features != int64(len(testgpkg.Features)) {
+		t.Errorf("got %d converted features, want %d", stats.Features, len(testgpkg.Features))
+	}
+	if stats.BlobsAfter >= stats.BlobsBefore {
+		t.Errorf("got blob size %d after, want less than %d", stats.BlobsAfter, stats.BlobsBefore)
+	}
+	if stats.FileBefore == 0 || stats.FileAfter == 0 {
+		t.Errorf("got file sizes %d and %d", stats.FileBefore, stats.FileAfter)
+	}
+
+	for _, typ := range blobTypes(t, src) {
+		if typ != binary.StandardType {
+			t.Errorf("got source blob type %s, want %s", typ, binary.StandardType)
+		}
+	}
+	for _, typ := range blobTypes(t, dst) {
+		if typ != binary.ExtendedType {
+			t.Errorf("got converted blob type %s, want %s", typ, binary.ExtendedType)
+		}
+	}
+
+	g, err := gpkg.Open(dst, "", []string{"name", "rank"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	g.Order = gpkg.Order{Column: "rank", Direction: gpkg.Desc}
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(3, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"inner", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := writer.Convert(src, dst, writer.ConvertOptions{Precision: precision(3)}); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrExist)
+	}
+}
+
+func TestConvertInPlace(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	if _, err := writer.Convert(path, "", writer.ConvertOptions{Precision: precision(3)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range blobTypes(t, path) {
+		if typ != binary.ExtendedType {
+			t.Errorf("got blob type %s, want %s", typ, binary.ExtendedType)
+		}
+	}
+
+	// converting again leaves the TWKB blobs unchanged
+	stats, err := writer.Convert(path, path, writer.ConvertOptions{Precision: precision(3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Features != 0 {
+		t.Errorf("got %d converted features, want 0", stats.Features)
+	}
+}
+
+func TestConvertUnknownTable(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	if _, err := writer.Convert(path, "", writer.ConvertOptions{Tables: []string{"missing"}}); err == nil {
+		t.Error("expected error for unknown table")
+	}
+}
+
+func TestConvertPrecision(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision *int
+		want      geom.XY
+	}{
+		{"default", nil, geom.XY{X: 12.34567, Y: -1.23456}},
+		{"explicit", precision(1), geom.XY{X: 12.3, Y: -1.2}},
+		{"explicit zero", precision(0), geom.XY{X: 12, Y: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "points.gpkg")
+			w, err := writer.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ft, err := w.CreateTable(writer.Table{Name: "points"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := geom.UnmarshalWKT("POINT(12.345678 -1.234567)")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ft.Insert(p); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := writer.Convert(path, "", writer.ConvertOptions{Precision: tt.precision}); err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			var got geom.XY
+			err = sqlitex.ExecuteTransient(conn, "SELECT geom FROM points", &sqlitex.ExecOptions{
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					b := make([]byte, stmt.ColumnLen(0))
+					stmt.ColumnBytes(0, b)
+					_, g, err := binary.Unmarshal(b)
+					if err != nil {
+						return err
+					}
+					got, _ = g.MustAsPoint().XY()
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(got.X-tt.want.X) > 1e-9 || math.Abs(got.Y-tt.want.Y) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertWAL(t *testing.T) {
+	src := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	dst := filepath.Join(t.TempDir(), "twkb.gpkg")
+
+	// Keep the update in the write-ahead log while the source is open
+	w, err := writer.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, sql := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA wal_autocheckpoint = 0",
+		"UPDATE places SET name = 'west' WHERE name = 'east'",
+	} {
+		if err := sqlitex.ExecuteTransient(w.Conn(), sql, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := writer.Convert(src, dst, writer.ConvertOptions{Precision: precision(3)}); err != nil {
+		t.Fatal(err)
+	}
+	g, err := gpkg.Open(dst, "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"west"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestConvertFailure(t *testing.T) {
+	src := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	dst := filepath.Join(t.TempDir(), "twkb.gpkg")
+
+	// TWKB supports up to 7 digits
+	opts := writer.ConvertOptions{Precision: precision(8)}
+	if _, err := writer.Convert(src, dst, opts); err == nil {
+		t.Fatal("expected error for invalid precision")
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v for %s, want it removed", err, dst)
+	}
+
+	if _, err := writer.Convert(src, "", opts); err == nil {
+		t.Fatal("expected error for invalid precision")
+	}
+	for _, typ := range blobTypes(t, src) {
+		if typ != binary.StandardType {
+			t.Errorf("got blob type %s, want %s", typ, binary.StandardType)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package writer
+
+import (
+	"github.com/peterstace/simplefeatures/geom"
+	"zombiezen.com/go/sqlite"
+)
+
+// The tests are in package writer_test, as they create their GeoPackages
+// with internal/testgpkg, which imports this package. These exports give
+// them access to the internals they check.
+
+var ColumnTypeOf = columnType
+
+func (w *GeoPackage) Conn() *sqlite.Conn {
+	return w.conn
+}
+
+func (w *GeoPackage) Exec(script string) error {
+	return w.exec(script)
+}
+
+func (t *FeatureTable) Encode(g geom.Geometry) ([]byte, error) {
+	return t.encode(g)
+}
@@ -0,0 +1,82 @@
+package writer
+
+import (
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"zombiezen.com/go/sqlite"
+)
+
+// registerFunctions registers the SQL functions used by the triggers of
+// the GeoPackage RTree Spatial Indexes extension, which GeoPackages
+// created by GDAL and this package use to keep their spatial index up
+// to date.
+func registerFunctions(conn *sqlite.Conn) error {
+	fns := map[string]func(e binary.Envelope) float64{
+		"ST_MinX": func(e binary.Envelope) float64 { return e.MinX },
+		"ST_MaxX": func(e binary.Envelope) float64 { return e.MaxX },
+		"ST_MinY": func(e binary.Envelope) float64 { return e.MinY },
+		"ST_MaxY": func(e binary.Envelope) float64 { return e.MaxY },
+	}
+	for name, fn := range fns {
+		fn := fn
+		err := conn.CreateFunction(name, &sqlite.FunctionImpl{
+			NArgs:         1,
+			Deterministic: true,
+			AllowIndirect: true,
+			Scalar: func(ctx sqlite.Context, args []sqlite.Value) (sqlite.Value, error) {
+				e, ok, err := envelope(args[0])
+				if err != nil || !ok {
+					return sqlite.Value{}, err
+				}
+				return sqlite.FloatValue(fn(e)), nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return conn.CreateFunction("ST_IsEmpty", &sqlite.FunctionImpl{
+		NArgs:         1,
+		Deterministic: true,
+		AllowIndirect: true,
+		Scalar: func(ctx sqlite.Context, args []sqlite.Value) (sqlite.Value, error) {
+			if args[0].Type() == sqlite.TypeNull {
+				return sqlite.Value{}, nil
+			}
+			_, ok, err := envelope(args[0])
+			if err != nil {
+				return sqlite.Value{}, err
+			}
+			if ok {
+				return sqlite.IntegerValue(0), nil
+			}
+			return sqlite.IntegerValue(1), nil
+		},
+	})
+}
+
+// envelope returns the envelope of the geometry blob v, read from its
+// header or computed from the decoded geometry if the header has none.
+// It returns false if v is NULL or an empty geometry.
+func envelope(v sqlite.Value) (binary.Envelope, bool, error) {
+	if v.Type() == sqlite.TypeNull {
+		return binary.Envelope{}, false, nil
+	}
+	b := v.Blob()
+	h, n, err := binary.ParseHeader(b)
+	if err != nil {
+		return binary.Envelope{}, false, err
+	}
+	if h.Empty() {
+		return binary.Envelope{}, false, nil
+	}
+	if h.EnvelopeContentsIndicatorCode() != binary.NoEnvelope {
+		return h.Envelope, true, nil
+	}
+	g, err := binary.UnmarshalPayload(&h, b[n:], geom.DisableAllValidations)
+	if err != nil {
+		return binary.Envelope{}, false, err
+	}
+	e, code := binary.EnvelopeOf(g)
+	return e, code != binary.NoEnvelope, nil
+}
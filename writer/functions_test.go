@@ -0,0 +1,71 @@
+package writer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestFunctions(t *testing.T) {
+	conn, err := sqlite.OpenConn(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := registerFunctions(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := func(wkt string, withEnvelope bool) []byte {
+		g, err := geom.UnmarshalWKT(wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := binary.NewHeader(4326, g)
+		if !withEnvelope {
+			h.SetEnvelopeContentsIndicatorCode(binary.NoEnvelope)
+		}
+		var buf bytes.Buffer
+		if err := h.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return g.AppendWKB(buf.Bytes())
+	}
+
+	tests := []struct {
+		name string
+		b    any
+		want string
+	}{
+		{name: "envelope", b: blob("LINESTRING(1 2,3 4)", true), want: "1.0 3.0 2.0 4.0 0"},
+		{name: "no envelope", b: blob("LINESTRING(1 2,3 4)", false), want: "1.0 3.0 2.0 4.0 0"},
+		{name: "empty", b: blob("POINT EMPTY", false), want: "    1"},
+		{name: "null", want: "    "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			err := sqlitex.Execute(conn, `
+				SELECT
+					ifnull(ST_MinX(:b), '') || ' ' || ifnull(ST_MaxX(:b), '') || ' ' ||
+					ifnull(ST_MinY(:b), '') || ' ' || ifnull(ST_MaxY(:b), '') || ' ' ||
+					ifnull(ST_IsEmpty(:b), '')`, &sqlitex.ExecOptions{
+				Named: map[string]any{":b": tt.b},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					got = stmt.ColumnText(0)
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
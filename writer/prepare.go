@@ -0,0 +1,265 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"github.com/smilyorg/tinygpkg/simplify"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// PrepareOptions configures Prepare
+type PrepareOptions struct {
+	// Table is the feature table to prepare, the first table in
+	// "gpkg_contents" if empty
+	Table string
+	// Simplify configures the simplification of the polygons
+	Simplify simplify.Options
+	// Precision is the number of decimal digits of the XY coordinates
+	// kept in the TWKB geometries, see Table
+	Precision int
+}
+
+// Prepare creates a GeoPackage at dst with the features of a table of the
+// GeoPackage at src, with their polygons simplified and made valid with
+// simplify.Polygons and written as TWKB geometries. The ids and
+// attributes of the features are kept, and features whose polygons
+// collapse are kept with an empty geometry. The ids are stored in the
+// "fid" primary key, so an attribute column named "fid" is renamed, e.g.
+// to "fid_1".
+//
+// All features of the table are simplified together in memory, so that
+// the borders shared between them are preserved. If writing dst fails, it
+// is removed.
+func Prepare(src, dst string, opts PrepareOptions) error {
+	conn, err := sqlite.OpenConn(src, sqlite.OpenReadOnly)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	s, err := readSource(conn, opts.Table)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", src, err)
+	}
+
+	gs, err := simplify.Polygons(s.geoms, opts.Simplify)
+	if err != nil {
+		return fmt.Errorf("error simplifying %s: %w", s.table.Name, err)
+	}
+
+	w, err := Create(dst)
+	if err != nil {
+		return err
+	}
+	s.table.Encoding = TWKB
+	s.table.Precision = opts.Precision
+	err = w.write(s, gs)
+	if err != nil {
+		w.conn.Close()
+	} else {
+		err = w.Close()
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+// write creates the table of s and inserts its features with the
+// geometries gs
+func (w *GeoPackage) write(s source, gs []geom.Geometry) error {
+	t, err := w.CreateTable(s.table)
+	if err != nil {
+		return err
+	}
+	for i, g := range gs {
+		if err := t.InsertId(s.fids[i], g, s.values[i]...); err != nil {
+			return fmt.Errorf("error writing feature %d: %w", s.fids[i], err)
+		}
+	}
+	return nil
+}
+
+// source are the definition and features of a table read by readSource
+type source struct {
+	table  Table
+	fids   []int64
+	geoms  []geom.Geometry
+	values [][]any
+}
+
+// readSource reads the definition and all features of the table, or of the
+// first table in "gpkg_contents" if it is empty
+func readSource(conn *sqlite.Conn, table string) (source, error) {
+	var s source
+	err := sqlitex.Execute(conn, `
+		SELECT c.table_name, g.column_name, g.geometry_type_name,
+			r.srs_name, r.srs_id, r.organization, r.organization_coordsys_id,
+			r.definition, ifnull(r.description, '')
+		FROM gpkg_contents c
+		JOIN gpkg_geometry_columns g ON g.table_name = c.table_name
+		JOIN gpkg_spatial_ref_sys r ON r.srs_id = g.srs_id
+		WHERE ? = '' OR c.table_name = ?
+		LIMIT 1`, &sqlitex.ExecOptions{
+		Args: []any{table, table},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			s.table = Table{
+				Name:           stmt.ColumnText(0),
+				GeometryColumn: stmt.ColumnText(1),
+				GeometryType:   stmt.ColumnText(2),
+				Srs: SpatialRefSys{
+					Name:           stmt.ColumnText(3),
+					Id:             stmt.ColumnInt32(4),
+					Organization:   stmt.ColumnText(5),
+					OrganizationId: stmt.ColumnInt64(6),
+					Definition:     stmt.ColumnText(7),
+					Description:    stmt.ColumnText(8),
+				},
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return s, err
+	}
+	if s.table.Name == "" {
+		if table == "" {
+			return s, errors.New("no feature table found")
+		}
+		return s, fmt.Errorf("feature table %s not found", table)
+	}
+	// Making polygons valid can turn them into multipolygons
+	if strings.EqualFold(s.table.GeometryType, "POLYGON") {
+		s.table.GeometryType = "GEOMETRY"
+	}
+
+	fid, err := sqlutil.PrimaryKey(conn, s.table.Name)
+	if err != nil {
+		return s, err
+	}
+	err = sqlitex.Execute(conn, `
+		SELECT name, type
+		FROM pragma_table_info(?)
+		ORDER BY cid`, &sqlitex.ExecOptions{
+		Args: []any{s.table.Name},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			name := stmt.ColumnText(0)
+			if name == fid || name == s.table.GeometryColumn {
+				return nil
+			}
+			s.table.Columns = append(s.table.Columns, Column{
+				Name: name,
+				Type: columnType(stmt.ColumnText(1)),
+			})
+			return nil
+		},
+	})
+	if err != nil {
+		return s, err
+	}
+
+	cols := []string{sqlutil.QuoteIdent(fid), sqlutil.QuoteIdent(s.table.GeometryColumn)}
+	for _, c := range s.table.Columns {
+		cols = append(cols, sqlutil.QuoteIdent(c.Name))
+	}
+
+	// The prepared table has its own "fid" primary key, so an attribute
+	// column with that name is renamed
+	taken := map[string]bool{
+		"fid":                                   true,
+		strings.ToLower(s.table.GeometryColumn): true,
+	}
+	for _, c := range s.table.Columns {
+		taken[strings.ToLower(c.Name)] = true
+	}
+	for i, c := range s.table.Columns {
+		if strings.EqualFold(c.Name, "fid") {
+			s.table.Columns[i].Name = uniqueName(c.Name, taken)
+		}
+	}
+
+	err = sqlitex.Execute(conn, `
+		SELECT `+strings.Join(cols, ", ")+`
+		FROM `+sqlutil.QuoteIdent(s.table.Name)+`
+		ORDER BY `+sqlutil.QuoteIdent(fid), &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			fid := stmt.ColumnInt64(0)
+			var g geom.Geometry
+			if stmt.ColumnType(1) != sqlite.TypeNull {
+				b := make([]byte, stmt.ColumnLen(1))
+				stmt.ColumnBytes(1, b)
+				var err error
+				_, g, err = binary.Unmarshal(b, geom.DisableAllValidations)
+				if err != nil {
+					return fmt.Errorf("feature %d: %w", fid, err)
+				}
+			}
+			values := make([]any, len(s.table.Columns))
+			for i := range values {
+				values[i] = columnValue(stmt, i+2)
+			}
+			s.fids = append(s.fids, fid)
+			s.geoms = append(s.geoms, g)
+			s.values = append(s.values, values)
+			return nil
+		},
+	})
+	return s, err
+}
+
+// uniqueName returns name with the first numeric suffix not in taken,
+// compared case-insensitively like SQL identifiers, and adds it to taken
+func uniqueName(name string, taken map[string]bool) string {
+	for n := 1; ; n++ {
+		unique := fmt.Sprintf("%s_%d", name, n)
+		if !taken[strings.ToLower(unique)] {
+			taken[strings.ToLower(unique)] = true
+			return unique
+		}
+	}
+}
+
+// columnType returns the ColumnType with the affinity of the declared SQL
+// type of a column, following the SQLite rules, with the GeoPackage
+// BOOLEAN type as Integer and DATE and DATETIME as Text
+func columnType(decl string) ColumnType {
+	decl = strings.ToUpper(decl)
+	switch {
+	case strings.Contains(decl, "INT"), decl == "BOOLEAN":
+		return Integer
+	case strings.Contains(decl, "CHAR"), strings.Contains(decl, "CLOB"),
+		strings.Contains(decl, "TEXT"), strings.HasPrefix(decl, "DATE"):
+		return Text
+	case decl == "", strings.Contains(decl, "BLOB"):
+		return Blob
+	default:
+		return Real
+	}
+}
+
+// columnValue returns the value of the column as the Go type of its
+// SQLite type
+func columnValue(stmt *sqlite.Stmt, col int) any {
+	switch stmt.ColumnType(col) {
+	case sqlite.TypeInteger:
+		return stmt.ColumnInt64(col)
+	case sqlite.TypeFloat:
+		return stmt.ColumnFloat(col)
+	case sqlite.TypeText:
+		return stmt.ColumnText(col)
+	case sqlite.TypeBlob:
+		b := make([]byte, stmt.ColumnLen(col))
+		stmt.ColumnBytes(col, b)
+		return b
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,202 @@
+package writer_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"github.com/smilyorg/tinygpkg/simplify"
+	"github.com/smilyorg/tinygpkg/writer"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestPrepare(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.gpkg")
+	dst := filepath.Join(dir, "dst.gpkg")
+
+	w, err := writer.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft, err := w.CreateTable(writer.Table{
+		Name:         "regions",
+		GeometryType: "POLYGON",
+		Columns: []writer.Column{
+			{Name: "name", Type: writer.Text},
+			{Name: "population", Type: writer.Integer},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions := []struct {
+		fid  int64
+		wkt  string
+		name string
+	}{
+		{fid: 10, wkt: "POLYGON((0 0,5 0,5.1 2,4.9 4,5.1 6,4.9 8,5 10,0 10,0 0))", name: "west"},
+		{fid: 20, wkt: "POLYGON((5 0,10 0,10 10,5 10,4.9 8,5.1 6,4.9 4,5.1 2,5 0))", name: "east"},
+		{fid: 30, wkt: "POLYGON((20 0,20.1 0,20.1 0.1,20 0))", name: "tiny"},
+	}
+	for _, r := range regions {
+		g, err := geom.UnmarshalWKT(r.wkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ft.InsertId(r.fid, g, r.name, r.fid*100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Prepare(src, dst, writer.PrepareOptions{
+		Simplify:  simplify.Options{Method: simplify.DouglasPeucker, Tolerance: 1},
+		Precision: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := gpkg.Open(dst, "regions", []string{"name", "population"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// Every point along the simplified shared border is in a region
+	for y := 0.5; y < 10; y += 0.5 {
+		for _, x := range []float64{4.95, 5, 5.05} {
+			f, err := g.ReverseGeocodeFeature(context.Background(), s2.LatLngFromDegrees(y, x))
+			if err != nil {
+				t.Fatalf("got %v at %v,%v", err, y, x)
+			}
+			want := "west"
+			if x > 5 {
+				want = "east"
+			}
+			if x != 5 && f.Values[0] != want {
+				t.Errorf("got %v at %v,%v, want %v", f.Values[0], y, x, want)
+			}
+		}
+	}
+
+	f, err := g.ReverseGeocodeFeature(context.Background(), s2.LatLngFromDegrees(5, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Id != 20 || f.Values[0] != "east" || f.Values[1] != int64(2000) {
+		t.Errorf("got feature %d %v, want 20 [east 2000]", f.Id, f.Values)
+	}
+
+	_, err = g.ReverseGeocodeFeature(context.Background(), s2.LatLngFromDegrees(0.01, 20.05))
+	if err != gpkg.ErrNotFound {
+		t.Errorf("got %v for collapsed region, want %v", err, gpkg.ErrNotFound)
+	}
+}
+
+func TestPrepareUnknownTable(t *testing.T) {
+	src := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	err := writer.Prepare(src, filepath.Join(t.TempDir(), "dst.gpkg"), writer.PrepareOptions{Table: "missing"})
+	if err == nil {
+		t.Error("expected error for unknown table")
+	}
+}
+
+func TestPrepareFailure(t *testing.T) {
+	src := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	dst := filepath.Join(t.TempDir(), "dst.gpkg")
+	// TWKB supports up to 7 digits
+	if err := writer.Prepare(src, dst, writer.PrepareOptions{Precision: 8}); err == nil {
+		t.Fatal("expected error for invalid precision")
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v for %s, want it removed", err, dst)
+	}
+}
+
+func TestPrepareFidColumn(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.gpkg")
+	dst := filepath.Join(dir, "dst.gpkg")
+
+	// A table with an "id" primary key and a "fid" attribute column
+	w, err := writer.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Exec(`
+		CREATE TABLE areas (id INTEGER PRIMARY KEY, geom BLOB, FID TEXT, fid_1 TEXT);
+		INSERT INTO gpkg_contents (table_name, data_type, srs_id) VALUES ('areas', 'features', 4326);
+		INSERT INTO gpkg_geometry_columns VALUES ('areas', 'geom', 'POLYGON', 4326, 0, 0);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := geom.UnmarshalWKT("POLYGON((0 0,10 0,10 10,0 10,0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := binary.Marshal(4326, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sqlitex.Execute(w.Conn(), `INSERT INTO areas VALUES (7, ?, 'a7', 'b7')`, &sqlitex.ExecOptions{
+		Args: []any{b},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Prepare(src, dst, writer.PrepareOptions{Precision: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := gpkg.Open(dst, "areas", []string{"FID_2", "fid_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	f, err := p.ReverseGeocodeFeature(context.Background(), s2.LatLngFromDegrees(5, 5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Id != 7 || f.Values[0] != "a7" || f.Values[1] != "b7" {
+		t.Errorf("got feature %d %v, want 7 [a7 b7]", f.Id, f.Values)
+	}
+}
+
+func TestColumnType(t *testing.T) {
+	tests := map[string]writer.ColumnType{
+		"INTEGER":   writer.Integer,
+		"MEDIUMINT": writer.Integer,
+		"BOOLEAN":   writer.Integer,
+		"TEXT(20)":  writer.Text,
+		"DATETIME":  writer.Text,
+		"DATE":      writer.Text,
+		"BLOB":      writer.Blob,
+		"":          writer.Blob,
+		"REAL":      writer.Real,
+		"DOUBLE":    writer.Real,
+		"FLOAT":     writer.Real,
+		"NUMERIC":   writer.Real,
+	}
+	for decl, want := range tests {
+		if got := writer.ColumnTypeOf(decl); got != want {
+			t.Errorf("got %s for %q, want %s", got, decl, want)
+		}
+	}
+}
@@ -0,0 +1,598 @@
+// Package writer creates GeoPackages with feature tables storing their
+// geometries as standard WKB or compressed TWKB geometry blobs, readable
+// by the gpkg package.
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/internal/sqlutil"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// applicationId is "GPKG" as a big endian 32-bit integer and userVersion
+// is version 1.3.0 of the GeoPackage spec
+const (
+	applicationId = 0x47504B47
+	userVersion   = 10300
+)
+
+// ExtensionTWKB is the name of the extension registered in
+// "gpkg_extensions" for geometry columns storing TWKB blobs
+const ExtensionTWKB = "tinygpkg_twkb"
+
+// DefaultPrecision is the Precision of TWKB geometries in geographic
+// coordinate systems if none is set, about 1 meter in degrees
+const DefaultPrecision = 5
+
+// Encoding is the encoding of the geometry blobs of a table
+type Encoding int
+
+const (
+	// WKB stores standard geometry blobs readable by any GeoPackage reader
+	WKB Encoding = iota
+	// TWKB stores extended geometry blobs with the binary.ExtensionTWKB
+	// code, which are considerably smaller but only readable by readers
+	// supporting the extension
+	TWKB
+)
+
+// ColumnType is the SQL type of an attribute column
+type ColumnType string
+
+const (
+	Integer ColumnType = "INTEGER"
+	Real    ColumnType = "REAL"
+	Text    ColumnType = "TEXT"
+	Blob    ColumnType = "BLOB"
+)
+
+// Column is an attribute column of a feature table
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// SpatialRefSys is a row of "gpkg_spatial_ref_sys"
+type SpatialRefSys struct {
+	Name           string
+	Id             int32
+	Organization   string
+	OrganizationId int64
+	Definition     string
+	Description    string
+}
+
+// WGS84 is the spatial reference system of longitude/latitude degrees
+var WGS84 = SpatialRefSys{
+	Name:           "WGS 84 geodetic",
+	Id:             4326,
+	Organization:   "EPSG",
+	OrganizationId: 4326,
+	Definition:     `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563,AUTHORITY["EPSG","7030"]],AUTHORITY["EPSG","6326"]],PRIMEM["Greenwich",0,AUTHORITY["EPSG","8901"]],UNIT["degree",0.0174532925199433,AUTHORITY["EPSG","9122"]],AXIS["Latitude",NORTH],AXIS["Longitude",EAST],AUTHORITY["EPSG","4326"]]`,
+	Description:    "longitude/latitude coordinates in decimal degrees on the WGS 84 spheroid",
+}
+
+// Table defines a feature table created by CreateTable
+type Table struct {
+	Name    string
+	Columns []Column
+	// GeometryColumn is the name of the geometry column, "geom" if empty
+	GeometryColumn string
+	// GeometryType is the geometry type name registered in
+	// "gpkg_geometry_columns", "GEOMETRY" if empty
+	GeometryType string
+	// Srs is the spatial reference system of the geometries, WGS84 if
+	// its Organization is empty
+	Srs      SpatialRefSys
+	Encoding Encoding
+	// Precision is the number of decimal digits of the XY coordinates
+	// kept when encoding TWKB, e.g. 3 for about 100 meters in degrees.
+	// If it is 0 and Srs is geographic, DefaultPrecision is used instead,
+	// as whole degrees are too coarse for almost any use.
+	Precision int
+}
+
+// GeoPackage is a GeoPackage open for writing
+//
+// All changes are made in a single transaction, which is committed on
+// Close.
+type GeoPackage struct {
+	conn *sqlite.Conn
+	tx   bool
+}
+
+// Create creates a new GeoPackage at path with the required metadata
+// tables. It returns an error if the file already exists, and removes the
+// file if creating the tables fails.
+func Create(path string) (*GeoPackage, error) {
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("error creating %s: %w", path, fs.ErrExist)
+	}
+	w, err := open(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	if err := w.init(); err != nil {
+		w.conn.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("error creating %s: %w", path, err)
+	}
+	return w, nil
+}
+
+// init creates the required metadata tables of a new GeoPackage
+func (w *GeoPackage) init() error {
+	err := w.exec(`
+		PRAGMA application_id = ` + fmt.Sprint(applicationId) + `;
+		PRAGMA user_version = ` + fmt.Sprint(userVersion) + `;
+		CREATE TABLE gpkg_spatial_ref_sys (
+			srs_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL PRIMARY KEY,
+			organization TEXT NOT NULL,
+			organization_coordsys_id INTEGER NOT NULL,
+			definition TEXT NOT NULL,
+			description TEXT
+		);
+		INSERT INTO gpkg_spatial_ref_sys VALUES
+			('Undefined cartesian SRS', -1, 'NONE', -1, 'undefined', 'undefined cartesian coordinate reference system'),
+			('Undefined geographic SRS', 0, 'NONE', 0, 'undefined', 'undefined geographic coordinate reference system');
+		CREATE TABLE gpkg_contents (
+			table_name TEXT NOT NULL PRIMARY KEY,
+			data_type TEXT NOT NULL,
+			identifier TEXT UNIQUE,
+			description TEXT DEFAULT '',
+			last_change DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now')),
+			min_x DOUBLE,
+			min_y DOUBLE,
+			max_x DOUBLE,
+			max_y DOUBLE,
+			srs_id INTEGER,
+			CONSTRAINT fk_gc_r_srs_id FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys(srs_id)
+		);
+		CREATE TABLE gpkg_geometry_columns (
+			table_name TEXT NOT NULL,
+			column_name TEXT NOT NULL,
+			geometry_type_name TEXT NOT NULL,
+			srs_id INTEGER NOT NULL,
+			z TINYINT NOT NULL,
+			m TINYINT NOT NULL,
+			CONSTRAINT pk_geom_cols PRIMARY KEY (table_name, column_name),
+			CONSTRAINT fk_gc_tn FOREIGN KEY (table_name) REFERENCES gpkg_contents(table_name),
+			CONSTRAINT fk_gc_srs FOREIGN KEY (srs_id) REFERENCES gpkg_spatial_ref_sys (srs_id)
+		);
+		CREATE TABLE gpkg_extensions (
+			table_name TEXT,
+			column_name TEXT,
+			extension_name TEXT NOT NULL,
+			definition TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			CONSTRAINT ge_tce UNIQUE (table_name, column_name, extension_name)
+		);
+	`)
+	if err != nil {
+		return err
+	}
+	return w.AddSpatialRefSys(WGS84)
+}
+
+// Open opens an existing GeoPackage at path for writing
+func Open(path string) (*GeoPackage, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return open(path)
+}
+
+func open(path string) (*GeoPackage, error) {
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadWrite|sqlite.OpenCreate)
+	if err != nil {
+		return nil, err
+	}
+	if err := registerFunctions(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &GeoPackage{conn: conn}, nil
+}
+
+// Close commits all changes, updates the extents of the tables in
+// "gpkg_contents" and closes the GeoPackage.
+func (w *GeoPackage) Close() error {
+	err := w.commit()
+	return errors.Join(err, w.conn.Close())
+}
+
+func (w *GeoPackage) commit() error {
+	if !w.tx {
+		return nil
+	}
+	err := w.updateExtents()
+	if err != nil {
+		w.conn.Prep("ROLLBACK").Step()
+		return err
+	}
+	w.tx = false
+	return sqlitex.ExecuteTransient(w.conn, "COMMIT", nil)
+}
+
+// begin starts the transaction of the GeoPackage if it is not running
+func (w *GeoPackage) begin() error {
+	if w.tx {
+		return nil
+	}
+	if err := sqlitex.ExecuteTransient(w.conn, "BEGIN", nil); err != nil {
+		return err
+	}
+	w.tx = true
+	return nil
+}
+
+// exec executes the SQL script in the transaction of the GeoPackage
+func (w *GeoPackage) exec(script string) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	return sqlitex.ExecuteScript(w.conn, script, nil)
+}
+
+// updateExtents sets the extents of the feature tables in "gpkg_contents"
+// to the extents of their spatial indexes, if they have one
+func (w *GeoPackage) updateExtents() error {
+	var rtrees []string
+	var tables []string
+	err := sqlitex.Execute(w.conn, `
+		SELECT table_name, column_name
+		FROM gpkg_geometry_columns
+		WHERE EXISTS (
+			SELECT 1
+			FROM sqlite_master
+			WHERE type = 'table' AND name = 'rtree_' || table_name || '_' || column_name
+		)`, &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			table := stmt.ColumnText(0)
+			tables = append(tables, table)
+			rtrees = append(rtrees, "rtree_"+table+"_"+stmt.ColumnText(1))
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for i, table := range tables {
+		err := sqlitex.Execute(w.conn, `
+			UPDATE gpkg_contents
+			SET (min_x, max_x, min_y, max_y) = (
+				SELECT min(minx), max(maxx), min(miny), max(maxy)
+				FROM `+sqlutil.QuoteIdent(rtrees[i])+`
+			)
+			WHERE table_name = ?`, &sqlitex.ExecOptions{
+			Args: []any{table},
+		})
+		if err != nil {
+			return fmt.Errorf("error updating extent of %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// AddSpatialRefSys adds srs to "gpkg_spatial_ref_sys" if there is no
+// system with its id yet
+func (w *GeoPackage) AddSpatialRefSys(srs SpatialRefSys) error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	var description any
+	if srs.Description != "" {
+		description = srs.Description
+	}
+	err := sqlitex.Execute(w.conn, `
+		INSERT OR IGNORE INTO gpkg_spatial_ref_sys
+		VALUES (?, ?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+		Args: []any{srs.Name, srs.Id, srs.Organization, srs.OrganizationId, srs.Definition, description},
+	})
+	if err != nil {
+		return fmt.Errorf("error adding spatial reference system %d: %w", srs.Id, err)
+	}
+	return nil
+}
+
+// FeatureTable is a feature table created by CreateTable
+type FeatureTable struct {
+	w      *GeoPackage
+	table  Table
+	insert string
+}
+
+// CreateTable creates a feature table with an integer primary key "fid",
+// a geometry column and the attribute columns of t. The table is
+// registered in "gpkg_contents" and "gpkg_geometry_columns", and an
+// "rtree_<table>_<geometry column>" spatial index is created, which is
+// kept up to date by triggers.
+//
+// Tables with the TWKB Encoding are registered with the ExtensionTWKB
+// extension.
+func (w *GeoPackage) CreateTable(t Table) (*FeatureTable, error) {
+	if t.Name == "" {
+		return nil, errors.New("table name is empty")
+	}
+	if t.GeometryColumn == "" {
+		t.GeometryColumn = "geom"
+	}
+	if t.GeometryType == "" {
+		t.GeometryType = "GEOMETRY"
+	}
+	if t.Srs.Organization == "" {
+		t.Srs = WGS84
+	}
+	if t.Encoding != WKB && t.Encoding != TWKB {
+		return nil, fmt.Errorf("unsupported encoding %d", t.Encoding)
+	}
+	t.Precision = precision(t.Precision, t.Srs)
+	if err := w.AddSpatialRefSys(t.Srs); err != nil {
+		return nil, err
+	}
+
+	cols := []string{
+		`"fid" INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL`,
+		sqlutil.QuoteIdent(t.GeometryColumn) + ` BLOB`,
+	}
+	names := []string{`"fid"`, sqlutil.QuoteIdent(t.GeometryColumn)}
+	params := []string{"?", "?"}
+	for _, c := range t.Columns {
+		switch c.Type {
+		case Integer, Real, Text, Blob:
+		default:
+			return nil, fmt.Errorf("unsupported type %q of column %s", c.Type, c.Name)
+		}
+		cols = append(cols, sqlutil.QuoteIdent(c.Name)+` `+string(c.Type))
+		names = append(names, sqlutil.QuoteIdent(c.Name))
+		params = append(params, "?")
+	}
+
+	table := sqlutil.QuoteIdent(t.Name)
+	err := w.exec(`CREATE TABLE ` + table + ` (` + strings.Join(cols, ", ") + `);`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating table %s: %w", t.Name, err)
+	}
+
+	err = sqlitex.Execute(w.conn, `
+		INSERT INTO gpkg_contents (table_name, data_type, identifier, srs_id)
+		VALUES (?, 'features', ?, ?)`, &sqlitex.ExecOptions{
+		Args: []any{t.Name, t.Name, t.Srs.Id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error registering table %s: %w", t.Name, err)
+	}
+	err = sqlitex.Execute(w.conn, `
+		INSERT INTO gpkg_geometry_columns
+		VALUES (?, ?, ?, ?, 0, 0)`, &sqlitex.ExecOptions{
+		Args: []any{t.Name, t.GeometryColumn, t.GeometryType, t.Srs.Id},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error registering geometry column of %s: %w", t.Name, err)
+	}
+	if t.Encoding == TWKB {
+		err := w.addExtension(t.Name, t.GeometryColumn, ExtensionTWKB,
+			"https://github.com/TWKB/Specification/blob/master/twkb.md", "read-write")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.createSpatialIndex(t.Name, t.GeometryColumn, "fid"); err != nil {
+		return nil, err
+	}
+
+	return &FeatureTable{
+		w:     w,
+		table: t,
+		insert: `INSERT INTO ` + table + ` (` + strings.Join(names, ", ") + `)
+			VALUES (` + strings.Join(params, ", ") + `)`,
+	}, nil
+}
+
+// addExtension registers an extension in "gpkg_extensions"
+func (w *GeoPackage) addExtension(table, column, name, definition, scope string) error {
+	err := sqlitex.Execute(w.conn, `
+		INSERT OR IGNORE INTO gpkg_extensions
+		VALUES (?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+		Args: []any{table, column, name, definition, scope},
+	})
+	if err != nil {
+		return fmt.Errorf("error registering extension %s: %w", name, err)
+	}
+	return nil
+}
+
+// createSpatialIndex creates the rtree spatial index of the geometry
+// column of the table with the triggers of the GeoPackage RTree Spatial
+// Indexes extension, and indexes the existing features.
+func (w *GeoPackage) createSpatialIndex(table, column, fid string) error {
+	rtree := "rtree_" + table + "_" + column
+	r := strings.NewReplacer(
+		"{rtree}", sqlutil.QuoteIdent(rtree),
+		"{insert}", sqlutil.QuoteIdent(rtree+"_insert"),
+		"{update1}", sqlutil.QuoteIdent(rtree+"_update1"),
+		"{update2}", sqlutil.QuoteIdent(rtree+"_update2"),
+		"{update3}", sqlutil.QuoteIdent(rtree+"_update3"),
+		"{update4}", sqlutil.QuoteIdent(rtree+"_update4"),
+		"{delete}", sqlutil.QuoteIdent(rtree+"_delete"),
+		"{table}", sqlutil.QuoteIdent(table),
+		"{geom}", sqlutil.QuoteIdent(column),
+		"{fid}", sqlutil.QuoteIdent(fid),
+	)
+	err := w.exec(r.Replace(`
+		CREATE VIRTUAL TABLE {rtree} USING rtree(id, minx, maxx, miny, maxy);
+		INSERT OR REPLACE INTO {rtree}
+			SELECT {fid}, ST_MinX({geom}), ST_MaxX({geom}), ST_MinY({geom}), ST_MaxY({geom})
+			FROM {table}
+			WHERE {geom} NOT NULL AND NOT ST_IsEmpty({geom});
+		CREATE TRIGGER {insert} AFTER INSERT ON {table}
+		WHEN (NEW.{geom} NOT NULL AND NOT ST_IsEmpty(NEW.{geom}))
+		BEGIN
+			INSERT OR REPLACE INTO {rtree} VALUES (
+				NEW.{fid},
+				ST_MinX(NEW.{geom}), ST_MaxX(NEW.{geom}),
+				ST_MinY(NEW.{geom}), ST_MaxY(NEW.{geom})
+			);
+		END;
+		CREATE TRIGGER {update1} AFTER UPDATE OF {geom} ON {table}
+		WHEN OLD.{fid} = NEW.{fid} AND (NEW.{geom} NOTNULL AND NOT ST_IsEmpty(NEW.{geom}))
+		BEGIN
+			INSERT OR REPLACE INTO {rtree} VALUES (
+				NEW.{fid},
+				ST_MinX(NEW.{geom}), ST_MaxX(NEW.{geom}),
+				ST_MinY(NEW.{geom}), ST_MaxY(NEW.{geom})
+			);
+		END;
+		CREATE TRIGGER {update2} AFTER UPDATE OF {geom} ON {table}
+		WHEN OLD.{fid} = NEW.{fid} AND (NEW.{geom} ISNULL OR ST_IsEmpty(NEW.{geom}))
+		BEGIN
+			DELETE FROM {rtree} WHERE id = OLD.{fid};
+		END;
+		CREATE TRIGGER {update3} AFTER UPDATE ON {table}
+		WHEN OLD.{fid} != NEW.{fid} AND (NEW.{geom} NOTNULL AND NOT ST_IsEmpty(NEW.{geom}))
+		BEGIN
+			DELETE FROM {rtree} WHERE id = OLD.{fid};
+			INSERT OR REPLACE INTO {rtree} VALUES (
+				NEW.{fid},
+				ST_MinX(NEW.{geom}), ST_MaxX(NEW.{geom}),
+				ST_MinY(NEW.{geom}), ST_MaxY(NEW.{geom})
+			);
+		END;
+		CREATE TRIGGER {update4} AFTER UPDATE ON {table}
+		WHEN OLD.{fid} != NEW.{fid} AND (NEW.{geom} ISNULL OR ST_IsEmpty(NEW.{geom}))
+		BEGIN
+			DELETE FROM {rtree} WHERE id IN (OLD.{fid}, NEW.{fid});
+		END;
+		CREATE TRIGGER {delete} AFTER DELETE ON {table}
+		WHEN OLD.{geom} NOT NULL
+		BEGIN
+			DELETE FROM {rtree} WHERE id = OLD.{fid};
+		END;
+	`))
+	if err != nil {
+		return fmt.Errorf("error creating spatial index %s: %w", rtree, err)
+	}
+	return w.addExtension(table, column, "gpkg_rtree_index",
+		"http://www.geopackage.org/spec120/#extension_rtree", "write-only")
+}
+
+// Insert inserts a feature with the geometry g, which may be empty, and
+// the values of the attribute columns in the order they were defined. It
+// returns the id of the inserted feature.
+//
+// Values can be nil, bools, integers, floats, strings and byte slices.
+func (t *FeatureTable) Insert(g geom.Geometry, values ...any) (int64, error) {
+	return t.insertFeature(nil, g, values)
+}
+
+// InsertId inserts a feature like Insert, with the given id instead of the
+// next one, e.g. to keep the ids of the features of another table.
+func (t *FeatureTable) InsertId(fid int64, g geom.Geometry, values ...any) error {
+	_, err := t.insertFeature(fid, g, values)
+	return err
+}
+
+func (t *FeatureTable) insertFeature(fid any, g geom.Geometry, values []any) (int64, error) {
+	if len(values) != len(t.table.Columns) {
+		return 0, fmt.Errorf("got %d values for %d columns", len(values), len(t.table.Columns))
+	}
+	b, err := t.encode(g)
+	if err != nil {
+		return 0, err
+	}
+	if err := t.w.begin(); err != nil {
+		return 0, err
+	}
+
+	stmt := t.w.conn.Prep(t.insert)
+	defer stmt.Reset()
+	if err := bind(stmt, 1, fid); err != nil {
+		return 0, err
+	}
+	stmt.BindBytes(2, b)
+	for i, v := range values {
+		if err := bind(stmt, i+3, v); err != nil {
+			return 0, fmt.Errorf("column %s: %w", t.table.Columns[i].Name, err)
+		}
+	}
+	if _, err := stmt.Step(); err != nil {
+		return 0, err
+	}
+	return t.w.conn.LastInsertRowID(), nil
+}
+
+// encode returns the geometry blob of g in the encoding of the table
+func (t *FeatureTable) encode(g geom.Geometry) ([]byte, error) {
+	switch t.table.Encoding {
+	case TWKB:
+		return binary.MarshalTWKB(t.table.Srs.Id, g, t.table.Precision)
+	default:
+		return binary.Marshal(t.table.Srs.Id, g)
+	}
+}
+
+// precision returns p, or DefaultPrecision if it is 0 and srs is
+// geographic
+func precision(p int, srs SpatialRefSys) int {
+	if p == 0 && srs.geographic() {
+		return DefaultPrecision
+	}
+	return p
+}
+
+// geographic reports whether the spatial reference system uses
+// longitude/latitude degrees
+func (s SpatialRefSys) geographic() bool {
+	if s.Id == 0 || strings.EqualFold(s.Organization, "EPSG") && s.OrganizationId == 4326 {
+		return true
+	}
+	def := strings.ToUpper(strings.TrimSpace(s.Definition))
+	return strings.HasPrefix(def, "GEOGCS[") || strings.HasPrefix(def, "GEOGCRS[")
+}
+
+// bind binds the attribute value v to the parameter i of stmt
+func bind(stmt *sqlite.Stmt, i int, v any) error {
+	switch v := v.(type) {
+	case nil:
+		stmt.BindNull(i)
+	case bool:
+		stmt.BindBool(i, v)
+	case int:
+		stmt.BindInt64(i, int64(v))
+	case int8:
+		stmt.BindInt64(i, int64(v))
+	case int16:
+		stmt.BindInt64(i, int64(v))
+	case int32:
+		stmt.BindInt64(i, int64(v))
+	case int64:
+		stmt.BindInt64(i, v)
+	case uint8:
+		stmt.BindInt64(i, int64(v))
+	case uint16:
+		stmt.BindInt64(i, int64(v))
+	case uint32:
+		stmt.BindInt64(i, int64(v))
+	case float32:
+		stmt.BindFloat(i, float64(v))
+	case float64:
+		stmt.BindFloat(i, v)
+	case string:
+		stmt.BindText(i, v)
+	case []byte:
+		stmt.BindBytes(i, v)
+	default:
+		return fmt.Errorf("unsupported value type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package writer_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/geo/s2"
+	"github.com/peterstace/simplefeatures/geom"
+	"github.com/smilyorg/tinygpkg/binary"
+	"github.com/smilyorg/tinygpkg/gpkg"
+	"github.com/smilyorg/tinygpkg/internal/testgpkg"
+	"github.com/smilyorg/tinygpkg/writer"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestCreate(t *testing.T) {
+	for _, enc := range []writer.Encoding{writer.WKB, writer.TWKB} {
+		path := testgpkg.Create(t, testgpkg.Options{Encoding: enc, Precision: 3, Empty: true})
+
+		g, err := gpkg.Open(path, "", []string{"name"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer g.Close()
+		g.Order = gpkg.Order{Column: "rank", Direction: gpkg.Desc}
+
+		tests := []struct {
+			lat, lng float64
+			want     []string
+		}{
+			{lat: 3, lng: 3, want: []string{"inner"}},
+			{lat: 6, lng: 6, want: []string{"outer"}},
+			{lat: 5, lng: 25, want: []string{"east"}},
+		}
+		for _, tt := range tests {
+			got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(tt.lat, tt.lng))
+			if err != nil {
+				t.Fatalf("encoding %d: %v", enc, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("encoding %d: got %v at %v,%v, want %v", enc, got, tt.lat, tt.lng, tt.want)
+			}
+		}
+	}
+}
+
+func TestCreateMetadata(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Encoding: writer.TWKB, Precision: 3, Empty: true})
+
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	query := func(sql string) []string {
+		t.Helper()
+		var rows []string
+		err := sqlitex.ExecuteTransient(conn, sql, &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				rows = append(rows, stmt.ColumnText(0))
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	if got := query("PRAGMA application_id"); got[0] != "1196444487" {
+		t.Errorf("got application id %v", got)
+	}
+	if got := query("SELECT srs_id FROM gpkg_spatial_ref_sys ORDER BY srs_id"); !reflect.DeepEqual(got, []string{"-1", "0", "4326"}) {
+		t.Errorf("got srs ids %v", got)
+	}
+	if got := query("SELECT extension_name FROM gpkg_extensions ORDER BY extension_name"); !reflect.DeepEqual(got, []string{"gpkg_rtree_index", writer.ExtensionTWKB}) {
+		t.Errorf("got extensions %v", got)
+	}
+	if got := query("SELECT min_x || ' ' || min_y || ' ' || max_x || ' ' || max_y FROM gpkg_contents"); !reflect.DeepEqual(got, []string{"0.0 0.0 30.0 10.0"}) {
+		t.Errorf("got extent %v", got)
+	}
+	// the empty feature is not indexed
+	if got := query("SELECT count(*) FROM rtree_places_geom"); got[0] != "3" {
+		t.Errorf("got %v indexed features, want 3", got)
+	}
+	got := query("SELECT hex(geom) FROM places WHERE name = 'inner'")
+	b, err := hex.DecodeString(got[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := binary.ParseHeader(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Type() != binary.ExtendedType || string(h.ExtensionCode) != string(binary.ExtensionTWKB) {
+		t.Errorf("got header %+v, want TWKB", h)
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	if _, err := writer.Create(path); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrExist)
+	}
+}
+
+func TestCreateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	// SQLite cannot create its rollback journal, so writing fails
+	if err := os.Mkdir(path+"-journal", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := writer.Create(path); err == nil {
+		w.Close()
+		t.Fatal("expected error for failing journal")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v for %s, want it removed", err, path)
+	}
+}
+
+func TestSpatialIndexTriggers(t *testing.T) {
+	path := testgpkg.Create(t, testgpkg.Options{Empty: true})
+	w, err := writer.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	count := func() int {
+		t.Helper()
+		n := 0
+		err := sqlitex.ExecuteTransient(w.Conn(), "SELECT count(*) FROM rtree_places_geom", &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				n = stmt.ColumnInt(0)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := w.Exec(`UPDATE places SET geom = NULL WHERE name = 'inner'`); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("got %d indexed features after update, want 2", n)
+	}
+	if err := w.Exec(`DELETE FROM places WHERE name = 'east'`); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("got %d indexed features after delete, want 1", n)
+	}
+}
+
+func TestCreateIdentifiers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	w, err := writer.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := `pla"ces'; CREATE TABLE injected(a); --`
+	ft, err := w.CreateTable(writer.Table{
+		Name:           table,
+		GeometryColumn: `ge"o'm`,
+		Columns:        []writer.Column{{Name: `na"me'`, Type: writer.Text}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range testgpkg.Features {
+		g, err := geom.UnmarshalWKT(f.WKT)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ft.Insert(g, f.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := sqlite.OpenConn(path, sqlite.OpenReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var names []string
+	err = sqlitex.ExecuteTransient(conn, "SELECT name FROM sqlite_master WHERE type = 'trigger' OR name = 'injected' ORDER BY name", &sqlitex.ExecOptions{
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			names = append(names, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, suffix := range []string{"delete", "insert", "update1", "update2", "update3", "update4"} {
+		want = append(want, "rtree_"+table+`_ge"o'm_`+suffix)
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q, want triggers %q", names, want)
+	}
+
+	g, err := gpkg.Open(path, table, []string{`na"me'`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	got, err := g.ReverseGeocode(context.Background(), s2.LatLngFromDegrees(5, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"east"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestInsertValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.gpkg")
+	w, err := writer.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	ft, err := w.CreateTable(testgpkg.Table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := geom.UnmarshalWKT("POINT(1 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ft.Insert(p, "a"); err == nil {
+		t.Error("expected error for missing value")
+	}
+	if _, err := ft.Insert(p, "a", struct{}{}); err == nil {
+		t.Error("expected error for unsupported value")
+	}
+	fid, err := ft.Insert(p, nil, int32(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fid != 1 {
+		t.Errorf("got fid %d, want 1", fid)
+	}
+}
+
+func TestCreatePrecision(t *testing.T) {
+	utm33n := writer.SpatialRefSys{
+		Name:           "WGS 84 / UTM zone 33N",
+		Id:             32633,
+		Organization:   "EPSG",
+		OrganizationId: 32633,
+		Definition:     `PROJCS["WGS 84 / UTM zone 33N",GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["central_meridian",15],PARAMETER["scale_factor",0.9996],PARAMETER["false_easting",500000],UNIT["metre",1]]`,
+	}
+	tests := []struct {
+		name      string
+		srs       writer.SpatialRefSys
+		precision int
+		want      geom.XY
+	}{
+		{"geographic default", writer.WGS84, 0, geom.XY{X: 12.34567, Y: -1.23456}},
+		{"geographic explicit", writer.WGS84, 1, geom.XY{X: 12.3, Y: -1.2}},
+		{"projected", utm33n, 0, geom.XY{X: 12, Y: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := writer.Create(filepath.Join(t.TempDir(), "test.gpkg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			ft, err := w.CreateTable(writer.Table{
+				Name:      "points",
+				Srs:       tt.srs,
+				Encoding:  writer.TWKB,
+				Precision: tt.precision,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := geom.UnmarshalWKT("POINT(12.345678 -1.234567)")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ft.Encode(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, g, err := binary.Unmarshal(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := g.MustAsPoint().XY()
+			if math.Abs(got.X-tt.want.X) > 1e-9 || math.Abs(got.Y-tt.want.Y) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}